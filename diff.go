@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/naoking158/go-to-trash/lib"
+)
+
+// runDiff shows what restoring the entry would change at its original path.
+func (cli *CLI) runDiff(args []string) int {
+	var verbose bool
+
+	flags := cli.newFlagSet(Name + " diff")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintf(cli.Stderr, "usage: %s diff <path|glob|id>\n", Name)
+		return 1
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	entries, err := trash.Entries()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	// the most recent match, like restore
+	matched, exitCode := cli.matchEntries(entries, flags.Args(), false)
+	if len(matched) == 0 {
+		return exitCode
+	}
+	entry := matched[0]
+
+	diffs, err := lib.DiffEntry(lib.OSFileSystem{}, entry)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to diff: %v\n", err)
+		return 1
+	}
+
+	if err := lib.WriteDiff(cli.Stdout, entry, diffs); err != nil {
+		fmt.Fprintf(cli.Stderr, "%v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+)
+
+// runEmpty removes entries from the trash permanently.
+func (cli *CLI) runEmpty(args []string) int {
+	var (
+		dryrun     bool
+		verbose    bool
+		yes        bool
+		olderThan  string
+		largerThan string
+		pattern    string
+		batch      string
+	)
+
+	flags := cli.newFlagSet(Name + " empty")
+	flags.BoolVarP(&dryrun, "dryrun", "n", false, "no execute, just show what would be done")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation")
+	flags.StringVar(&olderThan, "older-than", "", "only entries removed more than this long ago (e.g. 30d, 2w, 12h)")
+	flags.StringVar(&largerThan, "larger-than", "", "only entries larger than this size (e.g. 100M, 1G)")
+	flags.StringVar(&pattern, "match", "", "only entries whose original path matches this glob")
+	flags.StringVar(&batch, "batch", "", "only entries trashed by the invocation with this batch ID")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	filter := lib.EmptyFilter{Pattern: pattern, Batch: batch}
+	if olderThan != "" {
+		d, err := lib.ParseAge(olderThan)
+		if err != nil {
+			fmt.Fprintf(cli.Stderr, "%v\n", err)
+			return 1
+		}
+		// zero would not filter at all and select every entry
+		if d <= 0 {
+			fmt.Fprintf(cli.Stderr, "--older-than must be positive: %q\n", olderThan)
+			return 1
+		}
+		filter.OlderThan = d
+	}
+	if largerThan != "" {
+		size, err := lib.ParseSize(largerThan)
+		if err != nil {
+			fmt.Fprintf(cli.Stderr, "%v\n", err)
+			return 1
+		}
+		filter.LargerThan = size
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	entries, err := trash.Entries()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	selected, err := filter.Select(entries, time.Now())
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to select entries: %v\n", err)
+		return 1
+	}
+	if len(selected) == 0 {
+		if !dryrun {
+			// still lets the backend tidy up, e.g. the orphan info files of freedesktop
+			if _, err := trash.Purge(nil); err != nil {
+				log.Println(err)
+			}
+		}
+		fmt.Fprintln(cli.Stdout, "nothing to empty")
+		return 0
+	}
+
+	var total int64
+	for _, e := range selected {
+		size, err := lib.DiskUsage(e.To)
+		if err != nil {
+			log.Println(err)
+		}
+		total += size
+		fmt.Fprintf(cli.Stdout, "%s (%s, removed at %s) ← %s\n", e.To, lib.FormatSize(size), e.Removed, e.From)
+	}
+
+	if dryrun {
+		fmt.Fprintf(cli.Stdout, "would delete %d entries (%s)\n", len(selected), lib.FormatSize(total))
+		return 0
+	}
+
+	if !yes && !cli.confirmSubcommand("empty", fmt.Sprintf("permanently delete %d entries (%s)?", len(selected), lib.FormatSize(total))) {
+		fmt.Fprintln(cli.Stdout, "canceled")
+		return 1
+	}
+
+	purged, err := trash.Purge(selected)
+	for _, e := range purged {
+		fmt.Fprintf(cli.Stdout, "deleted: %s\n", e.To)
+	}
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to empty: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// confirm asks a yes/no question on the terminal. Anything but yes is no.
+func (cli *CLI) confirm(question string) bool {
+	fmt.Fprintf(cli.Stderr, "%s [y/N] ", question)
+
+	line, _ := cli.stdinReader().ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
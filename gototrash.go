@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"log"
-	"path/filepath"
+	"os"
 
+	"github.com/charmbracelet/x/term"
 	"github.com/spf13/pflag"
 
 	"github.com/naoking158/go-to-trash/lib"
@@ -15,26 +17,59 @@ const Name = "gototrash"
 
 // CLI is the main command line object
 type CLI struct {
-	Stdout, Stderr io.Writer
-	TrashDir       string
+	Stdin           io.Reader
+	Stdout, Stderr  io.Writer
+	TrashDir        string
+	Backend         string
+	RestoreConflict string
+	Quota           lib.Quota
+	HistoryStore    string
+
+	stdin *bufio.Reader
 }
 
 func (cli *CLI) Run(args []string) int {
+	// サブコマンド。同名のファイルを削除したい場合は `--` の後ろに置く。
+	// rm の代わりに使われても `rm empty` などで消えないよう、empty は確認し、restore などは端末から実行されたら確認する
+	if len(args) > 1 {
+		switch args[1] {
+		case "restore":
+			return cli.runRestore(args[2:])
+		case "empty":
+			return cli.runEmpty(args[2:])
+		case "list":
+			return cli.runList(args[2:])
+		case "migrate":
+			return cli.runMigrate(args[2:])
+		case "pin":
+			return cli.runPin(args[2:], true)
+		case "unpin":
+			return cli.runPin(args[2:], false)
+		case "undo":
+			return cli.runUndo(args[2:])
+		case "versions":
+			return cli.runVersions(args[2:])
+		case "diff":
+			return cli.runDiff(args[2:])
+		}
+	}
+
 	var (
-		dryrun  bool
-		verbose bool
-		restore bool
+		dryrun    bool
+		verbose   bool
+		restore   bool
+		restoreTo string
+		conflict  string
 	)
 
-	// pflag FlagSet (GNU 互換)。未定義フラグは黙って無視する
-	flags := pflag.NewFlagSet(Name, pflag.ContinueOnError)
-	flags.ParseErrorsWhitelist.UnknownFlags = true
-	flags.SetOutput(cli.Stderr)
+	flags := cli.newFlagSet(Name)
 
 	// 本来の CLI フラグ
 	flags.BoolVarP(&dryrun, "dryrun", "n", false, "no execute, just show what would be done")
 	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
 	flags.BoolVar(&restore, "restore", false, "restore files from trash")
+	flags.StringVar(&restoreTo, "to", "", "restore files into this directory instead of their original location")
+	flags.StringVar(&conflict, "conflict", cli.RestoreConflict, "what to do when a restored file already exists: fail, rename, overwrite or ask")
 
 	// rm 互換（動作には使わない）
 	var dummy bool
@@ -43,45 +78,28 @@ func (cli *CLI) Run(args []string) int {
 	flags.BoolVarP(&dummy, "Recursive", "R", false, "rm compatibility (ignored)")
 
 	// Parse flags
-	if err := flags.Parse(args[1:]); err != nil {
-		// -h/-help などでヘルプが要求された場合は正常終了扱いにする
-		if err == pflag.ErrHelp {
-			return 0
-		}
-		fmt.Fprintf(cli.Stderr, "failed to parse flags: %v\n", err)
-		return 1
+	if code, ok := cli.parse(flags, args[1:]); !ok {
+		return code
 	}
 
-	if verbose {
-		log.SetOutput(cli.Stderr)
-	} else {
-		log.SetOutput(io.Discard)
-	}
+	cli.setVerbose(verbose)
 
 	paths := flags.Args()
 
-	history, err := lib.LoadHistory(cli.TrashDir)
+	trash, err := cli.openTrash()
 	if err != nil {
-		log.Println(err)
-		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
-		return 1
-	}
-	if err := history.SyncHistory(); err != nil {
-		log.Println(err)
-		fmt.Fprintf(cli.Stderr, "failed to sync history: %v\n", err)
 		return 1
 	}
 
 	if restore {
-		if err := lib.Restore(history.Entries); err != nil {
-			log.Println(err)
-			fmt.Fprintf(cli.Stderr, "there's been an error: %v", err)
+		opts, err := cli.restoreOptions(restoreTo, conflict, dryrun)
+		if err != nil {
 			return 1
 		}
-		return 0
+		return cli.restoreInteractive(trash, opts)
 	}
 
-	removedFiles, err := cli.remove(paths, dryrun)
+	removedFiles, err := trash.Put(paths, dryrun)
 	if err != nil {
 		log.Println(err)
 		fmt.Fprintf(cli.Stderr, "failed to remove: %v\n", err)
@@ -90,36 +108,81 @@ func (cli *CLI) Run(args []string) int {
 
 	for _, f := range removedFiles {
 		fmt.Fprintf(cli.Stdout, "removed: %s → %s\n", f.From, f.To)
-	}
-
-	if err := history.UpdateHistory(lib.NewHistoryEntriesFromMovedFiles(removedFiles)); err != nil {
-		log.Println(err)
-		fmt.Fprintf(cli.Stderr, "failed to update history: %v\n", err)
-		return 1
+		if f.Leftover != nil {
+			fmt.Fprintf(cli.Stderr, "warning: %s has been copied to the trash, but is partly left: %v\n", f.From, f.Leftover)
+		}
 	}
 
 	return 0
 }
 
-func (cli *CLI) remove(paths []string, dryrun bool) ([]lib.MovedFile, error) {
-	toBeMovedFiles := make(lib.ToBeMovedFiles, len(paths))
-	for i, path := range paths {
-		from, err := lib.ValidatePath(path)
-		if err != nil {
-			log.Println(err)
-			fmt.Fprintf(cli.Stderr, "failed to validate path: %v\n", err)
-			return nil, fmt.Errorf("failed to validate path: %w", err)
-		}
+// newFlagSet returns pflag FlagSet (GNU 互換)。未定義フラグは黙って無視する
+func (cli *CLI) newFlagSet(name string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(cli.Stderr)
+	return flags
+}
 
-		to := filepath.Join(cli.TrashDir, filepath.Base(path))
+// parse parses args and returns false with the exit code if the command should not continue.
+func (cli *CLI) parse(flags *pflag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		// -h/-help などでヘルプが要求された場合は正常終了扱いにする
+		if err == pflag.ErrHelp {
+			return 0, false
+		}
+		fmt.Fprintf(cli.Stderr, "failed to parse flags: %v\n", err)
+		return 1, false
+	}
+	return 0, true
+}
 
-		toBeMovedFiles[i] = lib.NewToBeMovedFile(from, to)
+func (cli *CLI) setVerbose(verbose bool) {
+	if verbose {
+		log.SetOutput(cli.Stderr)
+	} else {
+		log.SetOutput(io.Discard)
 	}
+}
 
-	movedFiles, err := toBeMovedFiles.Move(dryrun)
+func (cli *CLI) openTrash() (lib.Trash, error) {
+	trash, err := lib.NewTrash(cli.Backend, cli.TrashDir, lib.TrashOptions{Quota: cli.Quota, HistoryStore: cli.HistoryStore})
 	if err != nil {
-		return nil, fmt.Errorf("failed to move files: %w", err)
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to open trash: %v\n", err)
+		return nil, err
 	}
+	return trash, nil
+}
 
-	return movedFiles, nil
+// isTerminal tells whether r is a terminal, replaced by the tests.
+var isTerminal = func(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(f.Fd())
+}
+
+// stdinIsTerminal tells whether there is someone to ask on stdin.
+func (cli *CLI) stdinIsTerminal() bool {
+	return isTerminal(cli.Stdin)
+}
+
+// confirmSubcommand is confirm for the subcommands which would be run by mistake
+// when gototrash is used as rm, e.g. `rm empty` meaning to trash the file `empty`.
+func (cli *CLI) confirmSubcommand(name, question string) bool {
+	fmt.Fprintf(cli.Stderr, "to trash a file named %q instead, run `%s -- %s`\n", name, Name, name)
+	return cli.confirm(question)
+}
+
+// guardSubcommand is confirmSubcommand only on a terminal and unless yes:
+// scripts can run the subcommand without a terminal, but a person typing `rm restore foo` is asked.
+func (cli *CLI) guardSubcommand(name, question string, yes bool) bool {
+	return yes || !cli.stdinIsTerminal() || cli.confirmSubcommand(name, question)
+}
+
+// stdinReader keeps the reader since it may buffer the answers to the following questions
+func (cli *CLI) stdinReader() *bufio.Reader {
+	if cli.stdin == nil {
+		cli.stdin = bufio.NewReader(cli.Stdin)
+	}
+	return cli.stdin
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: ゴミ箱に file を入れた CLI
+func trashedCLI(t *testing.T) (*CLI, string) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, os.WriteFile(file, []byte("file"), 0644))
+
+	cli := &CLI{
+		Stdin:    strings.NewReader(""),
+		Stdout:   new(bytes.Buffer),
+		Stderr:   new(bytes.Buffer),
+		TrashDir: filepath.Join(dir, "trash"),
+	}
+	assert.Equal(t, 0, cli.Run([]string{Name, file}))
+	assert.NoFileExists(t, file)
+	return cli, file
+}
+
+// rm の代わりに端末から実行されたサブコマンドは確認され、断れば何もしない
+func TestRun_GuardSubcommands(t *testing.T) {
+	defer func(f func(io.Reader) bool) { isTerminal = f }(isTerminal)
+	isTerminal = func(io.Reader) bool { return true }
+
+	for _, args := range [][]string{
+		{"restore"},
+		{"pin"},
+		{"unpin"},
+		{"migrate"},
+		{"undo"},
+		{"empty"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			cli, file := trashedCLI(t)
+			if args[0] == "restore" || args[0] == "pin" || args[0] == "unpin" {
+				args = append(args, file)
+			}
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			cli.Stdin, cli.Stdout, cli.Stderr = strings.NewReader("n\n"), stdout, stderr
+
+			assert.Equal(t, 1, cli.Run(append([]string{Name}, args...)))
+			assert.Contains(t, stderr.String(), "run `gototrash -- "+args[0]+"`")
+			assert.Contains(t, stdout.String(), "canceled")
+			assert.NoFileExists(t, file)
+		})
+	}
+
+	// --yes なら確認しない
+	cli, file := trashedCLI(t)
+	stderr := new(bytes.Buffer)
+	cli.Stderr = stderr
+	assert.Equal(t, 0, cli.Run([]string{Name, "restore", "--yes", file}))
+	assert.NotContains(t, stderr.String(), "gototrash --")
+	assert.FileExists(t, file)
+}
+
+// 端末でなければスクリプトから確認なしで実行できる
+func TestRun_SubcommandsWithoutTerminal(t *testing.T) {
+	cli, file := trashedCLI(t)
+	assert.Equal(t, 0, cli.Run([]string{Name, "pin", file}))
+	assert.Equal(t, 0, cli.Run([]string{Name, "restore", file}))
+	assert.FileExists(t, file)
+}
@@ -0,0 +1,16 @@
+package lib
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// atime returns the access time of fi, or its mtime if unknown.
+func atime(fi os.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(st.Atimespec.Unix())
+}
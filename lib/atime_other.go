@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package lib
+
+import (
+	"os"
+	"time"
+)
+
+// atime is not supported, so the mtime is used instead.
+func atime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"slices"
+	"time"
+)
+
+// BatchEntries are the entries trashed by one invocation.
+type BatchEntries struct {
+	// ID is the batch ID, or empty for the entries recorded without metadata,
+	// which are grouped by their removal time instead.
+	ID      string
+	Entries HistoryEntries
+}
+
+// Removed is when the batch was trashed, the latest removal time of its entries.
+func (b BatchEntries) Removed() time.Time {
+	var latest time.Time
+	for _, e := range b.Entries {
+		if t := e.Removed.Time(); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// Batch returns the invocation recorded with the entries, if any.
+func (b BatchEntries) Batch() (Batch, bool) {
+	for _, e := range b.Entries {
+		if e.Metadata != nil {
+			return e.Metadata.Batch, true
+		}
+	}
+	return Batch{}, false
+}
+
+// BatchID returns the batch ID of the entry, or empty if it has none.
+func (e HistoryEntry) BatchID() string {
+	if e.Metadata == nil {
+		return ""
+	}
+	return e.Metadata.ID
+}
+
+// GroupByBatch groups the entries by batch, from the most recent batch.
+func GroupByBatch(entries HistoryEntries) []BatchEntries {
+	batches := make([]BatchEntries, 0)
+	index := make(map[string]int)
+	for _, e := range entries.Sorted() {
+		key := e.BatchID()
+		if key == "" {
+			// the files trashed at once share the removal time
+			key = "@" + e.Removed.String()
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(batches)
+			index[key] = i
+			batches = append(batches, BatchEntries{ID: e.BatchID()})
+		}
+		batches[i].Entries = append(batches[i].Entries, e)
+	}
+
+	slices.SortStableFunc(batches, func(a, b BatchEntries) int {
+		return b.Removed().Compare(a.Removed())
+	})
+	return batches
+}
+
+// FindBatch returns the batch with id.
+func FindBatch(entries HistoryEntries, id string) (BatchEntries, bool) {
+	if id == "" {
+		return BatchEntries{}, false
+	}
+	for _, b := range GroupByBatch(entries) {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return BatchEntries{}, false
+}
@@ -0,0 +1,54 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupByBatch(t *testing.T) {
+	at := func(sec int) lib.RemovedAt {
+		return lib.RemovedAt(time.Date(2024, 1, 1, 0, 0, sec, 0, time.UTC))
+	}
+	withBatch := func(e lib.HistoryEntry, id string) lib.HistoryEntry {
+		e.Metadata = &lib.Metadata{Batch: lib.Batch{ID: id, Cmdline: []string{"gototrash", e.From}}}
+		return e
+	}
+	entries := lib.HistoryEntries{
+		withBatch(lib.NewHistoryEntry("/a", "/trash/a", at(10)), "aaaaaaaa"),
+		withBatch(lib.NewHistoryEntry("/b", "/trash/b", at(30)), "bbbbbbbb"),
+		// 別のボリュームに入ったものは時刻がずれても同じバッチ
+		withBatch(lib.NewHistoryEntry("/mnt/a", "/mnt/.Trash-1000/a", at(11)), "aaaaaaaa"),
+		// メタデータの無い古いエントリは削除時刻でまとめる
+		lib.NewHistoryEntry("/old1", "/trash/old1", at(1)),
+		lib.NewHistoryEntry("/old2", "/trash/old2", at(1)),
+		lib.NewHistoryEntry("/old3", "/trash/old3", at(2)),
+	}
+
+	batches := lib.GroupByBatch(entries)
+	ids := make([]string, len(batches))
+	sizes := make([]int, len(batches))
+	for i, b := range batches {
+		ids[i] = b.ID
+		sizes[i] = len(b.Entries)
+	}
+	assert.Equal(t, []string{"bbbbbbbb", "aaaaaaaa", "", ""}, ids)
+	assert.Equal(t, []int{1, 2, 1, 2}, sizes)
+	assert.Equal(t, at(11).Time(), batches[1].Removed())
+
+	batch, ok := batches[1].Batch()
+	assert.True(t, ok)
+	assert.Equal(t, "aaaaaaaa", batch.ID)
+	_, ok = batches[3].Batch()
+	assert.False(t, ok)
+
+	found, ok := lib.FindBatch(entries, "aaaaaaaa")
+	assert.True(t, ok)
+	assert.Len(t, found.Entries, 2)
+	_, ok = lib.FindBatch(entries, "cccccccc")
+	assert.False(t, ok)
+	_, ok = lib.FindBatch(entries, "")
+	assert.False(t, ok)
+}
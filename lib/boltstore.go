@@ -0,0 +1,276 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	BoltHistoryFileName = "go-to-trash-history.db"
+	// BoltHistoryVersion is the schema version of the bolt store.
+	BoltHistoryVersion = 1
+)
+
+var (
+	// entries by path in trash
+	bucketEntries = []byte("entries")
+	// indices whose keys end with the path in trash, and values are empty
+	bucketByFrom    = []byte("by_from")
+	bucketByRemoved = []byte("by_removed")
+	bucketMeta      = []byte("meta")
+
+	keyVersion = []byte("version")
+)
+
+var _ HistoryStore = (*BoltHistoryStore)(nil)
+
+// BoltHistoryStore keeps the history in a bbolt database indexed by original path and removed time,
+// so that queries don't read the whole history.
+type BoltHistoryStore struct {
+	db      *bolt.DB
+	path    string
+	timeout time.Duration
+}
+
+func OpenBoltHistoryStore(path string, timeout time.Duration) (*BoltHistoryStore, error) {
+	db, err := openBoltDB(path, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketEntries, bucketByFrom, bucketByRemoved, bucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		meta := tx.Bucket(bucketMeta)
+		v := meta.Get(keyVersion)
+		if v == nil {
+			return meta.Put(keyVersion, binary.BigEndian.AppendUint64(nil, BoltHistoryVersion))
+		}
+		if version := int(binary.BigEndian.Uint64(v)); version > BoltHistoryVersion {
+			return errors.Wrapf(ErrHistoryTooNew,
+				"%v is version %d but this gototrash supports up to %d, please upgrade gototrash", path, version, BoltHistoryVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "init store")
+	}
+
+	return &BoltHistoryStore{db: db, path: path, timeout: timeout}, nil
+}
+
+func openBoltDB(path string, timeout time.Duration) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %v", path)
+	}
+	return db, nil
+}
+
+func (s *BoltHistoryStore) Close() error {
+	return s.db.Close()
+}
+
+// Path is the file of the database.
+func (s *BoltHistoryStore) Path() string {
+	return s.path
+}
+
+// Compact copies the database into a new file and replaces it, since bbolt never shrinks the file
+// after entries are removed.
+func (s *BoltHistoryStore) Compact() error {
+	tmpPath := s.path + ".compact"
+	dst, err := openBoltDB(tmpPath, s.timeout)
+	if err != nil {
+		return err
+	}
+	// no-op once renamed
+	defer os.Remove(tmpPath)
+
+	if err := bolt.Compact(dst, s.db, 0); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "compact")
+	}
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "close compacted store")
+	}
+
+	if err := s.db.Close(); err != nil {
+		return errors.Wrap(err, "close store")
+	}
+	renameErr := os.Rename(tmpPath, s.path)
+	// reopen even if the rename failed, so that the store stays usable
+	db, err := openBoltDB(s.path, s.timeout)
+	if err != nil {
+		return errors.Join(renameErr, err)
+	}
+	s.db = db
+	return errors.Wrap(renameErr, "replace store")
+}
+
+func (s *BoltHistoryStore) Load() (HistoryEntries, error) {
+	entries := make(HistoryEntries, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// in removed order, like the JSONL history
+		return tx.Bucket(bucketByRemoved).ForEach(func(k, _ []byte) error {
+			return s.appendEntry(tx, &entries, removedIndexPath(k))
+		})
+	})
+	return entries, errors.Wrap(err, "load")
+}
+
+func (s *BoltHistoryStore) Append(entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			if err := deleteEntry(tx, []byte(e.To)); err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				return errors.Wrap(err, "marshal entry")
+			}
+			if err := tx.Bucket(bucketEntries).Put([]byte(e.To), data); err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucketByFrom).Put(fromIndexKey(e), nil); err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucketByRemoved).Put(removedIndexKey(e.Removed.Time(), e.To), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "append")
+}
+
+func (s *BoltHistoryStore) Remove(entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			if err := deleteEntry(tx, []byte(e.To)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "remove")
+}
+
+// Query uses the most selective index for q, and filters the rest.
+func (s *BoltHistoryStore) Query(q HistoryQuery) (HistoryEntries, error) {
+	candidates := make(HistoryEntries, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		switch {
+		case q.To != "":
+			return s.appendEntry(tx, &candidates, []byte(q.To))
+
+		case q.From != "" || q.FromPrefix != "":
+			prefix := []byte(q.FromPrefix)
+			if q.From != "" {
+				prefix = append([]byte(q.From), 0)
+			}
+			c := tx.Bucket(bucketByFrom).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				_, to, _ := bytes.Cut(k, []byte{0})
+				if err := s.appendEntry(tx, &candidates, to); err != nil {
+					return err
+				}
+			}
+			return nil
+
+		default:
+			c := tx.Bucket(bucketByRemoved).Cursor()
+			var k []byte
+			if q.Since.IsZero() {
+				k, _ = c.First()
+			} else {
+				k, _ = c.Seek(removedIndexKey(q.Since, ""))
+			}
+			for ; k != nil; k, _ = c.Next() {
+				if !q.Until.IsZero() && bytes.Compare(k[:8], removedIndexKey(q.Until, "")) >= 0 {
+					break
+				}
+				if err := s.appendEntry(tx, &candidates, removedIndexPath(k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+
+	matched := make(HistoryEntries, 0, len(candidates))
+	for _, e := range candidates {
+		if q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+func (s *BoltHistoryStore) appendEntry(tx *bolt.Tx, entries *HistoryEntries, to []byte) error {
+	data := tx.Bucket(bucketEntries).Get(to)
+	if data == nil {
+		return nil
+	}
+	var e HistoryEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return errors.Wrapf(errors.Join(err, ErrHistoryInvalid), "entry %s", to)
+	}
+	*entries = append(*entries, e)
+	return nil
+}
+
+func deleteEntry(tx *bolt.Tx, to []byte) error {
+	data := tx.Bucket(bucketEntries).Get(to)
+	if data == nil {
+		return nil
+	}
+	var e HistoryEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return errors.Wrapf(errors.Join(err, ErrHistoryInvalid), "entry %s", to)
+	}
+
+	if err := tx.Bucket(bucketByFrom).Delete(fromIndexKey(e)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketByRemoved).Delete(removedIndexKey(e.Removed.Time(), e.To)); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketEntries).Delete(to)
+}
+
+// fromIndexKey is `from \0 to`, so that a prefix scan finds the entries under a directory.
+func fromIndexKey(e HistoryEntry) []byte {
+	return []byte(e.From + "\x00" + e.To)
+}
+
+// removedIndexKey is the unix nano time followed by the path in trash, so that keys sort by time.
+// The sign bit is flipped for times before 1970 to sort first.
+func removedIndexKey(t time.Time, to string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano())^(1<<63)), to...)
+}
+
+func removedIndexPath(k []byte) []byte {
+	return k[8:]
+}
@@ -12,7 +12,11 @@ import (
 const DefaultTrashDir = "~/.myTrash"
 
 type Config struct {
-	TrashDir string `json:"trashDir"`
+	TrashDir        string `json:"trashDir"`
+	Backend         string `json:"backend"`
+	RestoreConflict string `json:"restoreConflict"`
+	Quota           Quota  `json:"quota"`
+	HistoryStore    string `json:"historyStore"`
 }
 
 func NewConfig() (*Config, error) {
@@ -51,12 +55,29 @@ func loadConfig() (*Config, error) {
 			return nil, errors.Wrap(err, "decode config.json")
 		}
 
+		if _, err := ParseConflictPolicy(cfg.RestoreConflict); err != nil {
+			return nil, errors.Wrap(err, "restoreConflict")
+		}
+
+		if err := cfg.Quota.Validate(); err != nil {
+			return nil, errors.Wrap(err, "quota")
+		}
+
+		if err := ValidateHistoryStore(cfg.HistoryStore); err != nil {
+			return nil, errors.Wrap(err, "historyStore")
+		}
+
+		if cfg.Backend == BackendFreedesktop && cfg.TrashDir == "" {
+			cfg.TrashDir = DefaultFreedesktopTrashDir()
+		}
+
 		normalizedTrashDir, err := NormalizePath(cfg.TrashDir)
 		if err != nil {
 			return nil, errors.Wrap(err, "normalize trashDir")
 		}
 
-		if _, err := os.Stat(normalizedTrashDir); err != nil {
+		// the freedesktop trash is created on demand as the spec requires
+		if _, err := os.Stat(normalizedTrashDir); err != nil && cfg.Backend != BackendFreedesktop {
 			log.Printf("%v is not exist. Create it.", normalizedTrashDir)
 			return nil, errors.Wrap(err, "os.stat trashDir")
 		}
@@ -67,6 +88,8 @@ func loadConfig() (*Config, error) {
 	// no config file
 	dir, _ := NormalizePath(DefaultTrashDir)
 	return &Config{
-		TrashDir: dir,
+		TrashDir:        dir,
+		Backend:         BackendHistory,
+		RestoreConflict: string(DefaultConflictPolicy),
 	}, nil
 }
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ConflictPolicy decides what to do when the restore destination already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictFail refuses to restore anything if any destination exists.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictRename restores under a new name, which is reported.
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictOverwrite moves the current file to the trash and restores in its place.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictAsk asks the user for each conflict.
+	ConflictAsk ConflictPolicy = "ask"
+	// ConflictSkip leaves the entry in the trash. It's only chosen as an answer to ConflictAsk.
+	ConflictSkip ConflictPolicy = "skip"
+
+	DefaultConflictPolicy = ConflictRename
+)
+
+var (
+	ErrRestoreConflict       = errors.New("restore destination already exists")
+	ErrInvalidConflictPolicy = errors.New("invalid conflict policy")
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(s)); p {
+	case "":
+		return DefaultConflictPolicy, nil
+	case ConflictFail, ConflictRename, ConflictOverwrite, ConflictAsk:
+		return p, nil
+	default:
+		return "", errors.Wrapf(ErrInvalidConflictPolicy, "%q (fail, rename, overwrite or ask)", s)
+	}
+}
+
+// RestoreConflict is an entry whose destination is already taken,
+// either by an existing file or by another entry restored at the same time.
+type RestoreConflict struct {
+	Entry HistoryEntry
+	Dest  string
+}
+
+func (c RestoreConflict) String() string {
+	return fmt.Sprintf("%v → %v", MapHomeToTilde(c.Entry.To), MapHomeToTilde(c.Dest))
+}
+
+// RestoreConflicts returns the entries which conflict on restore.
+func RestoreConflicts(entries HistoryEntries, opts RestoreOptions) []RestoreConflict {
+	conflicts := make([]RestoreConflict, 0)
+	taken := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		dest := restoreDestination(entry, opts)
+		if isTaken(opts.FS, dest, taken) {
+			conflicts = append(conflicts, RestoreConflict{Entry: entry, Dest: dest})
+		}
+		taken[dest] = struct{}{}
+	}
+	return conflicts
+}
+
+func isTaken(fsys FileSystem, path string, taken map[string]struct{}) bool {
+	if _, ok := taken[path]; ok {
+		return true
+	}
+	_, err := fsOrOS(fsys).Lstat(path)
+	return err == nil
+}
+
+// restorePlan is the destination of each entry after the conflicts are resolved.
+type restorePlan struct {
+	files       ToBeMovedFiles
+	entries     map[string]HistoryEntry
+	renamed     map[string]bool
+	overwritten []string
+	skipped     HistoryEntries
+}
+
+func planRestore(entries HistoryEntries, opts RestoreOptions, now time.Time) (*restorePlan, error) {
+	policy := opts.Conflict
+	if policy == "" {
+		policy = DefaultConflictPolicy
+	}
+
+	plan := &restorePlan{
+		files:   make(ToBeMovedFiles, 0, len(entries)),
+		entries: make(map[string]HistoryEntry, len(entries)),
+		renamed: make(map[string]bool),
+		skipped: make(HistoryEntries, 0),
+	}
+
+	failed := make([]string, 0)
+	taken := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		dest := restoreDestination(entry, opts)
+
+		if isTaken(opts.FS, dest, taken) {
+			decision := policy
+			if decision == ConflictAsk {
+				if opts.Ask == nil {
+					return nil, errors.Wrap(ErrInvalidConflictPolicy, "ask needs a prompt")
+				}
+				answer, err := opts.Ask(RestoreConflict{Entry: entry, Dest: dest})
+				if err != nil {
+					return nil, errors.Wrap(err, "ask")
+				}
+				decision = answer
+			}
+
+			switch decision {
+			case ConflictFail:
+				failed = append(failed, dest)
+				continue
+			case ConflictSkip:
+				plan.skipped = append(plan.skipped, entry)
+				continue
+			case ConflictRename:
+				dest = freeRestoreName(opts.FS, dest, now, taken)
+				plan.renamed[entry.To] = true
+			case ConflictOverwrite:
+				// another entry restored to the same place can't be overwritten
+				if _, ok := taken[dest]; ok {
+					dest = freeRestoreName(opts.FS, dest, now, taken)
+					plan.renamed[entry.To] = true
+				} else {
+					plan.overwritten = append(plan.overwritten, dest)
+				}
+			default:
+				return nil, errors.Wrapf(ErrInvalidConflictPolicy, "%q", decision)
+			}
+		}
+
+		taken[dest] = struct{}{}
+		plan.files = append(plan.files, NewToBeMovedFile(entry.To, dest))
+		plan.entries[entry.To] = entry
+	}
+
+	if len(failed) > 0 {
+		return nil, errors.Wrapf(ErrRestoreConflict, "%v", failed)
+	}
+
+	return plan, nil
+}
+
+// freeRestoreName returns a name which is not taken, with a timestamp suffix and an index if needed.
+func freeRestoreName(fsys FileSystem, path string, now time.Time, taken map[string]struct{}) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	stamp := now.Format(DuplicatedTimeFormat)
+
+	name := fmt.Sprintf("%s.%s%s", base, stamp, ext)
+	for i := 1; isTaken(fsys, name, taken); i++ {
+		name = fmt.Sprintf("%s.%s(%d)%s", base, stamp, i, ext)
+	}
+	return name
+}
@@ -0,0 +1,121 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: ファイルをゴミ箱に入れた後、同じ場所に新しいファイルを作って衝突させる
+func trashAndRecreate(t *testing.T) (*lib.HistoryTrash, lib.HistoryEntries, string) {
+	t.Helper()
+	trash := lib.NewHistoryTrash(t.TempDir())
+	src := filepath.Join(t.TempDir(), "file.txt")
+	createDummyFile(t, src)
+
+	_, err := trash.Put([]string{src}, false)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(src, []byte("current"), 0644))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	return trash, entries, src
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	p, err := lib.ParseConflictPolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, lib.DefaultConflictPolicy, p)
+
+	p, err = lib.ParseConflictPolicy("Overwrite")
+	assert.NoError(t, err)
+	assert.Equal(t, lib.ConflictOverwrite, p)
+
+	// skip は ask の回答としてのみ使える
+	_, err = lib.ParseConflictPolicy("skip")
+	assert.ErrorIs(t, err, lib.ErrInvalidConflictPolicy)
+}
+
+// fail: 何も復元せずにエラーになる
+func TestRestoreEntries_ConflictFail(t *testing.T) {
+	trash, entries, src := trashAndRecreate(t)
+
+	_, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{Conflict: lib.ConflictFail})
+	assert.ErrorIs(t, err, lib.ErrRestoreConflict)
+	assert.FileExists(t, entries[0].To)
+
+	data, err := os.ReadFile(src)
+	assert.NoError(t, err)
+	assert.Equal(t, "current", string(data))
+}
+
+// rename: 別名で復元され、そのことが報告される
+func TestRestoreEntries_ConflictRename(t *testing.T) {
+	trash, entries, src := trashAndRecreate(t)
+
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{Conflict: lib.ConflictRename})
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	assert.True(t, restored[0].Renamed)
+	assert.NotEqual(t, src, restored[0].To)
+	assert.True(t, strings.HasPrefix(filepath.Base(restored[0].To), "file."))
+	assert.FileExists(t, restored[0].To)
+	assert.FileExists(t, src)
+}
+
+// overwrite: 現在のファイルをゴミ箱に入れてから元の場所に復元する
+func TestRestoreEntries_ConflictOverwrite(t *testing.T) {
+	trash, entries, src := trashAndRecreate(t)
+
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{Conflict: lib.ConflictOverwrite})
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	assert.Equal(t, src, restored[0].To)
+	assert.NotEmpty(t, restored[0].Overwritten)
+
+	data, err := os.ReadFile(src)
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy", string(data))
+
+	// 上書きされたファイルはゴミ箱に残っている
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, restored[0].Overwritten, entries[0].To)
+}
+
+// ask: 回答に従う (skip ならゴミ箱に残す)
+func TestRestoreEntries_ConflictAsk(t *testing.T) {
+	trash, entries, src := trashAndRecreate(t)
+
+	var asked []lib.RestoreConflict
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{
+		Conflict: lib.ConflictAsk,
+		Ask: func(c lib.RestoreConflict) (lib.ConflictPolicy, error) {
+			asked = append(asked, c)
+			return lib.ConflictSkip, nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, restored)
+	assert.Len(t, asked, 1)
+	assert.Equal(t, src, asked[0].Dest)
+	assert.FileExists(t, entries[0].To)
+}
+
+// 同時に復元するエントリ同士の衝突も検出される
+func TestRestoreConflicts_WithinBatch(t *testing.T) {
+	dir := t.TempDir()
+	entries := lib.HistoryEntries{
+		lib.NewHistoryEntry(filepath.Join(dir, "a.txt"), "/trash/a.txt", lib.RemovedAt{}),
+		lib.NewHistoryEntry(filepath.Join(dir, "a.txt"), "/trash/a.2.txt", lib.RemovedAt{}),
+	}
+
+	conflicts := lib.RestoreConflicts(entries, lib.RestoreOptions{})
+	assert.Len(t, conflicts, 1)
+	assert.Equal(t, "/trash/a.2.txt", conflicts[0].Entry.To)
+}
@@ -0,0 +1,239 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrCopyUnsupported = errors.New("unsupported file type for copy")
+	ErrCopyMismatch    = errors.New("copied file does not match the source")
+	// ErrSourceLeftOver is the failure to remove the source after a complete copy, so the file has been moved
+	// but part of the source is left.
+	ErrSourceLeftOver = errors.New("source is left after copy")
+)
+
+// moveFile renames from to to.
+// When they are on different filesystems, it copies from, verifies the copy and then removes from,
+// which only the OS file system supports.
+func moveFile(fsys FileSystem, from, to string) error {
+	err := fsys.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) || !isOS(fsys) {
+		return errors.Wrap(err, "os.rename")
+	}
+
+	log.Printf("%v and %v are on different filesystems, copy instead", from, to)
+
+	// never copy into, nor clean up, something this call has not created
+	if _, err := os.Lstat(to); err == nil {
+		return errors.Wrapf(os.ErrExist, "destination exists: %v", to)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "lstat destination")
+	}
+
+	created, err := copyNode(from, to)
+	if err != nil {
+		if created {
+			_ = removeAll(to)
+		}
+		return errors.Wrap(err, "copy")
+	}
+	if err := verifyTree(from, to); err != nil {
+		_ = removeAll(to)
+		return errors.Wrap(err, "verify")
+	}
+
+	// the copy is complete, so keep it even if the source is only partially removed
+	if err := os.RemoveAll(from); err != nil {
+		return errors.Wrapf(errors.Join(err, ErrSourceLeftOver), "remove source after copy: %v", from)
+	}
+
+	return nil
+}
+
+// copyTree recursively copies from to to, preserving mode, mtime, ownership, symlinks and xattrs.
+func copyTree(from, to string) error {
+	_, err := copyNode(from, to)
+	return err
+}
+
+// copyNode is copyTree, which also tells whether to has been created, even if the copy failed afterwards.
+// to is created exclusively, so it's not created if it already exists.
+func copyNode(from, to string) (created bool, err error) {
+	fi, err := os.Lstat(from)
+	if err != nil {
+		return false, errors.Wrap(err, "lstat")
+	}
+
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(from)
+		if err != nil {
+			return false, errors.Wrap(err, "readlink")
+		}
+		if err := os.Symlink(target, to); err != nil {
+			return false, errors.Wrap(err, "symlink")
+		}
+
+	case fi.IsDir():
+		// writable until the children are copied, the mode is restored afterwards
+		if err := os.Mkdir(to, 0700); err != nil {
+			return false, errors.Wrap(err, "mkdir")
+		}
+		children, err := os.ReadDir(from)
+		if err != nil {
+			return true, errors.Wrap(err, "readdir")
+		}
+		for _, c := range children {
+			if err := copyTree(filepath.Join(from, c.Name()), filepath.Join(to, c.Name())); err != nil {
+				return true, err
+			}
+		}
+
+	case fi.Mode().IsRegular():
+		dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return false, errors.Wrap(err, "create destination")
+		}
+		if err := copyFileContents(from, dst); err != nil {
+			return true, err
+		}
+
+	default:
+		return false, errors.Wrapf(ErrCopyUnsupported, "%v (%v)", from, fi.Mode().Type())
+	}
+
+	return true, copyMetadata(from, to, fi)
+}
+
+// copyFileContents copies from into dst and closes it.
+func copyFileContents(from string, dst *os.File) error {
+	src, err := os.Open(from)
+	if err != nil {
+		dst.Close()
+		return errors.Wrap(err, "open source")
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "copy contents")
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "fsync")
+	}
+	return dst.Close()
+}
+
+func copyMetadata(from, to string, fi os.FileInfo) error {
+	if err := copyXattrs(from, to); err != nil {
+		return errors.Wrap(err, "copy xattrs")
+	}
+	if err := copyOwner(to, fi); err != nil {
+		return errors.Wrap(err, "copy owner")
+	}
+
+	// symlinks have no mode of their own
+	if fi.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(to, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return errors.Wrap(err, "chmod")
+		}
+	}
+
+	if err := copyTimes(to, fi); err != nil {
+		return errors.Wrap(err, "copy times")
+	}
+	return nil
+}
+
+// verifyTree checks that to has the same structure and contents as from.
+func verifyTree(from, to string) error {
+	src, err := os.Lstat(from)
+	if err != nil {
+		return errors.Wrap(err, "lstat source")
+	}
+	dst, err := os.Lstat(to)
+	if err != nil {
+		return errors.Wrap(err, "lstat destination")
+	}
+
+	if src.Mode().Type() != dst.Mode().Type() {
+		return errors.Wrapf(ErrCopyMismatch, "type of %v", to)
+	}
+
+	switch {
+	case src.Mode()&os.ModeSymlink != 0:
+		srcTarget, err := os.Readlink(from)
+		if err != nil {
+			return errors.Wrap(err, "readlink source")
+		}
+		dstTarget, err := os.Readlink(to)
+		if err != nil {
+			return errors.Wrap(err, "readlink destination")
+		}
+		if srcTarget != dstTarget {
+			return errors.Wrapf(ErrCopyMismatch, "link target of %v", to)
+		}
+
+	case src.IsDir():
+		srcChildren, err := os.ReadDir(from)
+		if err != nil {
+			return errors.Wrap(err, "readdir source")
+		}
+		dstChildren, err := os.ReadDir(to)
+		if err != nil {
+			return errors.Wrap(err, "readdir destination")
+		}
+		if len(srcChildren) != len(dstChildren) {
+			return errors.Wrapf(ErrCopyMismatch, "number of children of %v", to)
+		}
+		for _, c := range srcChildren {
+			if err := verifyTree(filepath.Join(from, c.Name()), filepath.Join(to, c.Name())); err != nil {
+				return err
+			}
+		}
+
+	default:
+		if src.Size() != dst.Size() {
+			return errors.Wrapf(ErrCopyMismatch, "size of %v", to)
+		}
+		srcSum, err := fileChecksum(OSFileSystem{}, from)
+		if err != nil {
+			return err
+		}
+		dstSum, err := fileChecksum(OSFileSystem{}, to)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(srcSum, dstSum) {
+			return errors.Wrapf(ErrCopyMismatch, "checksum of %v", to)
+		}
+	}
+
+	return nil
+}
+
+func fileChecksum(fsys FileSystem, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	return h.Sum(nil), nil
+}
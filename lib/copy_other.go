@@ -0,0 +1,18 @@
+//go:build !unix
+
+package lib
+
+import (
+	"os"
+)
+
+func copyOwner(path string, fi os.FileInfo) error {
+	return nil
+}
+
+func copyTimes(path string, fi os.FileInfo) error {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	return os.Chtimes(path, atime(fi), fi.ModTime())
+}
@@ -0,0 +1,163 @@
+//go:build unix
+
+package lib_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: ファイル・ディレクトリ・シンボリックリンクを含むツリーを作成する
+func createDummyTree(t *testing.T, root string) {
+	t.Helper()
+	createDummyFile(t, filepath.Join(root, "file.txt"))
+	createDummyFile(t, filepath.Join(root, "sub", "nested.txt"))
+	assert.NoError(t, os.Symlink("file.txt", filepath.Join(root, "link")))
+	assert.NoError(t, os.Chmod(filepath.Join(root, "file.txt"), 0640))
+
+	mtime := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	atime := time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(root, "sub", "nested.txt"), atime, mtime))
+	assert.NoError(t, os.Chtimes(filepath.Join(root, "sub"), mtime, mtime))
+}
+
+// コピーでモード・atime・mtime・シンボリックリンクが保持され、検証に通る
+func TestCopyTree(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	dst := filepath.Join(t.TempDir(), "dst")
+	createDummyTree(t, src)
+
+	assert.NoError(t, lib.CopyTree(src, dst))
+
+	// 読み出しで atime は変わりうるので、検証の前にコピー元に設定した値と比べる
+	fi, err := os.Stat(filepath.Join(dst, "sub", "nested.txt"))
+	assert.NoError(t, err)
+	assert.True(t, lib.Atime(fi).Equal(time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)), lib.Atime(fi))
+
+	assert.NoError(t, lib.VerifyTree(src, dst))
+
+	fi, err = os.Stat(filepath.Join(dst, "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "file.txt", target)
+
+	for _, name := range []string{"sub", filepath.Join("sub", "nested.txt")} {
+		srcInfo, err := os.Stat(filepath.Join(src, name))
+		assert.NoError(t, err)
+		dstInfo, err := os.Stat(filepath.Join(dst, name))
+		assert.NoError(t, err)
+		assert.True(t, srcInfo.ModTime().Equal(dstInfo.ModTime()), name)
+	}
+}
+
+// 中身が異なるコピーは検証で検出される
+func TestVerifyTree_Mismatch(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	dst := filepath.Join(t.TempDir(), "dst")
+	createDummyTree(t, src)
+	assert.NoError(t, lib.CopyTree(src, dst))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "file.txt"), []byte("DUMMY"), 0640))
+	assert.ErrorIs(t, lib.VerifyTree(src, dst), lib.ErrCopyMismatch)
+
+	assert.NoError(t, os.Remove(filepath.Join(dst, "link")))
+	assert.ErrorIs(t, lib.VerifyTree(src, dst), lib.ErrCopyMismatch)
+}
+
+// 別のファイルシステムへの移動はコピーと削除で行われる（/dev/shm が使える環境のみ）
+func TestMoveFile_CrossDevice(t *testing.T) {
+	src, shm := crossDevice(t)
+
+	dst := filepath.Join(shm, "dst")
+	assert.NoError(t, lib.MoveFile(src, dst))
+	assert.NoDirExists(t, src)
+	assert.FileExists(t, filepath.Join(dst, "sub", "nested.txt"))
+}
+
+// helper: 別のファイルシステム上の作業ディレクトリとコピー元
+func crossDevice(t *testing.T) (src, shm string) {
+	t.Helper()
+	shm, err := os.MkdirTemp("/dev/shm", "gototrash-test-")
+	if err != nil {
+		t.Skip("/dev/shm is not available")
+	}
+	t.Cleanup(func() { os.RemoveAll(shm) })
+
+	src = filepath.Join(t.TempDir(), "src")
+	if same, err := lib.SameDevice(src, shm); err != nil || same {
+		t.Skip("/dev/shm is on the same filesystem")
+	}
+	createDummyTree(t, src)
+	return src, shm
+}
+
+func TestMoveFile_CrossDeviceDestinationExists(t *testing.T) {
+	src, shm := crossDevice(t)
+
+	// コピー先に既にあるものは上書きも削除もしない
+	dst := filepath.Join(shm, "dst")
+	assert.NoError(t, os.WriteFile(dst, []byte("keep"), 0644))
+
+	err := lib.MoveFile(filepath.Join(src, "file.txt"), dst)
+	assert.ErrorIs(t, err, os.ErrExist)
+	content, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "keep", string(content))
+	assert.FileExists(t, filepath.Join(src, "file.txt"))
+}
+
+func TestMoveFile_CrossDeviceCopyFails(t *testing.T) {
+	src, shm := crossDevice(t)
+	// コピーできない名前付きパイプで途中で失敗させる
+	assert.NoError(t, syscall.Mkfifo(filepath.Join(src, "zz-fifo"), 0644))
+
+	// 途中まで作ったコピーは片付け、元は残す
+	dst := filepath.Join(shm, "dst")
+	err := lib.MoveFile(src, dst)
+	assert.ErrorIs(t, err, lib.ErrCopyUnsupported)
+	assert.NoDirExists(t, dst)
+	assert.FileExists(t, filepath.Join(src, "sub", "nested.txt"))
+}
+
+// helper: path を消せないようにする。root はパーミッションを無視するので chattr を使う
+func makeUnremovable(t *testing.T, path string) {
+	t.Helper()
+	if os.Getuid() != 0 {
+		dir := filepath.Dir(path)
+		assert.NoError(t, os.Chmod(dir, 0500))
+		t.Cleanup(func() { os.Chmod(dir, 0700) })
+		return
+	}
+	if err := exec.Command("chattr", "+i", path).Run(); err != nil {
+		t.Skipf("chattr is not available: %v", err)
+	}
+	t.Cleanup(func() { exec.Command("chattr", "-i", path).Run() })
+}
+
+// コピーが終わった後に元を消せなくても、移動したものとして扱い、残ったことを知らせる
+func TestMoveFile_CrossDeviceSourceLeftOver(t *testing.T) {
+	src, shm := crossDevice(t)
+	makeUnremovable(t, filepath.Join(src, "sub", "nested.txt"))
+
+	dst := filepath.Join(shm, "dst")
+	moved, err := lib.ToBeMovedFiles{lib.NewToBeMovedFile(src, dst)}.Move(false)
+	assert.NoError(t, err)
+	assert.Len(t, moved, 1)
+	assert.Equal(t, dst, moved[0].To)
+	assert.ErrorIs(t, moved[0].Leftover, lib.ErrSourceLeftOver)
+	assert.FileExists(t, filepath.Join(dst, "sub", "nested.txt"))
+	assert.FileExists(t, filepath.Join(src, "sub", "nested.txt"))
+
+	// moveFile 自体は区別できるエラーを返す
+	assert.ErrorIs(t, lib.MoveFile(src, filepath.Join(shm, "dst2")), lib.ErrSourceLeftOver)
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package lib
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sys/unix"
+)
+
+// copyOwner copies uid/gid of fi to path. Without privileges only the group may change, so EPERM is ignored.
+func copyOwner(path string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := os.Lchown(path, int(st.Uid), int(st.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
+
+// copyTimes copies atime/mtime of fi to path without following symlinks.
+func copyTimes(path string, fi os.FileInfo) error {
+	atime := unix.NsecToTimeval(atime(fi).UnixNano())
+	mtime := unix.NsecToTimeval(fi.ModTime().UnixNano())
+	return unix.Lutimes(path, []unix.Timeval{atime, mtime})
+}
@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// MaxDiffSize is the size of the largest file compared line by line. Larger files are only summarized.
+const MaxDiffSize = 1 << 20
+
+type DiffStatus string
+
+const (
+	// DiffAdded is a file only in trash, which restoring brings back.
+	DiffAdded DiffStatus = "added"
+	// DiffRemoved is a file only at the original path, which the trashed copy doesn't have.
+	DiffRemoved DiffStatus = "removed"
+	// DiffModified is a file at both places with different contents or types.
+	DiffModified DiffStatus = "modified"
+)
+
+// FileDiff is a difference between what is at the original path of an entry and its copy in trash.
+type FileDiff struct {
+	// Path is relative to the entry, `.` for the entry itself.
+	Path   string
+	Status DiffStatus
+	// Binary is true for the files which are not compared line by line.
+	Binary bool
+	// Summary describes the difference when there is no unified diff.
+	Summary string
+	// Unified is the unified diff from the current file to the trashed one.
+	Unified string
+}
+
+// DiffEntry compares what is now at the original path of e with its copy in trash, recursively for directories.
+// No differences means restoring e would change nothing. fsys is the OS file system if nil.
+func DiffEntry(fsys FileSystem, e HistoryEntry) ([]FileDiff, error) {
+	diffs := make([]FileDiff, 0)
+	if err := diffTree(fsOrOS(fsys), e.From, e.To, ".", &diffs); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// diffTree compares current and trashed, which are at rel in the entry.
+func diffTree(fsys FileSystem, current, trashed, rel string, diffs *[]FileDiff) error {
+	tfi, err := fsys.Lstat(trashed)
+	if err != nil {
+		if os.IsNotExist(err) {
+			tfi = nil
+		} else {
+			return errors.Wrap(err, "lstat trashed")
+		}
+	}
+	cfi, err := fsys.Lstat(current)
+	if err != nil {
+		if os.IsNotExist(err) {
+			cfi = nil
+		} else {
+			return errors.Wrap(err, "lstat current")
+		}
+	}
+
+	switch {
+	case tfi == nil && cfi == nil:
+		return nil
+	case cfi == nil:
+		*diffs = append(*diffs, FileDiff{Path: rel, Status: DiffAdded, Summary: "only in trash"})
+		return nil
+	case tfi == nil:
+		*diffs = append(*diffs, FileDiff{Path: rel, Status: DiffRemoved, Summary: "only at the original path"})
+		return nil
+	case fileType(cfi) != fileType(tfi):
+		*diffs = append(*diffs, FileDiff{
+			Path:    rel,
+			Status:  DiffModified,
+			Summary: fmt.Sprintf("%s → %s", fileType(cfi), fileType(tfi)),
+		})
+		return nil
+	}
+
+	switch {
+	case tfi.IsDir():
+		return diffDirs(fsys, current, trashed, rel, diffs)
+
+	case tfi.Mode()&os.ModeSymlink != 0:
+		ct, err := fsys.Readlink(current)
+		if err != nil {
+			return errors.Wrap(err, "readlink current")
+		}
+		tt, err := fsys.Readlink(trashed)
+		if err != nil {
+			return errors.Wrap(err, "readlink trashed")
+		}
+		if ct != tt {
+			*diffs = append(*diffs, FileDiff{
+				Path:    rel,
+				Status:  DiffModified,
+				Summary: fmt.Sprintf("symlink %s → %s", ct, tt),
+			})
+		}
+		return nil
+
+	case tfi.Mode().IsRegular():
+		d, err := diffFiles(fsys, current, trashed, cfi, tfi)
+		if err != nil || d == nil {
+			return err
+		}
+		d.Path = rel
+		*diffs = append(*diffs, *d)
+		return nil
+
+	default:
+		// devices, sockets and pipes have no contents to compare
+		return nil
+	}
+}
+
+func diffDirs(fsys FileSystem, current, trashed, rel string, diffs *[]FileDiff) error {
+	names := make([]string, 0)
+	for _, dir := range []string{current, trashed} {
+		children, err := readDir(fsys, dir)
+		if err != nil {
+			return errors.Wrapf(err, "%v", dir)
+		}
+		for _, c := range children {
+			names = append(names, c.Name())
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range slices.Compact(names) {
+		err := diffTree(fsys, filepath.Join(current, name), filepath.Join(trashed, name), filepath.Join(rel, name), diffs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffFiles returns the difference of the regular files, or nil if they're the same.
+func diffFiles(fsys FileSystem, current, trashed string, cfi, tfi os.FileInfo) (*FileDiff, error) {
+	if cfi.Size() > MaxDiffSize || tfi.Size() > MaxDiffSize {
+		same, err := sameContents(fsys, current, trashed, cfi, tfi)
+		if err != nil || same {
+			return nil, err
+		}
+		return &FileDiff{
+			Status:  DiffModified,
+			Binary:  true,
+			Summary: fmt.Sprintf("files differ (%s → %s)", FormatSize(cfi.Size()), FormatSize(tfi.Size())),
+		}, nil
+	}
+
+	cdata, err := readFile(fsys, current)
+	if err != nil {
+		return nil, errors.Wrap(err, "read current")
+	}
+	tdata, err := readFile(fsys, trashed)
+	if err != nil {
+		return nil, errors.Wrap(err, "read trashed")
+	}
+	if bytes.Equal(cdata, tdata) {
+		return nil, nil
+	}
+
+	if isBinary(cdata) || isBinary(tdata) {
+		return &FileDiff{
+			Status:  DiffModified,
+			Binary:  true,
+			Summary: fmt.Sprintf("binary files differ (%s → %s)", FormatSize(cfi.Size()), FormatSize(tfi.Size())),
+		}, nil
+	}
+
+	unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(cdata)),
+		B:        splitLines(string(tdata)),
+		FromFile: MapHomeToTilde(current),
+		ToFile:   MapHomeToTilde(trashed),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unified diff")
+	}
+	return &FileDiff{Status: DiffModified, Unified: unified}, nil
+}
+
+// sameContents compares the files without reading them whole.
+func sameContents(fsys FileSystem, current, trashed string, cfi, tfi os.FileInfo) (bool, error) {
+	if cfi.Size() != tfi.Size() {
+		return false, nil
+	}
+	csum, err := fileChecksum(fsys, current)
+	if err != nil {
+		return false, err
+	}
+	tsum, err := fileChecksum(fsys, trashed)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(csum, tsum), nil
+}
+
+// noNewlineAtEnd follows an unterminated last line in the unified diff, like diff(1).
+const noNewlineAtEnd = "\n\\ No newline at end of file\n"
+
+// splitLines splits text after each newline.
+// An unterminated last line keeps noNewlineAtEnd, so that it differs from the same line terminated.
+// difflib.SplitLines would add an empty line at the end.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += noNewlineAtEnd
+	return lines
+}
+
+// isBinary is true if data has a NUL byte or is not UTF-8, like most diff tools guess.
+func isBinary(data []byte) bool {
+	head := data[:min(len(data), 8000)]
+	return bytes.IndexByte(head, 0) >= 0 || !utf8.Valid(data)
+}
+
+// WriteDiff writes the differences like `diff -ru`, from the current file to the trashed one.
+func WriteDiff(w io.Writer, e HistoryEntry, diffs []FileDiff) error {
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintf(w, "no differences: %s and %s\n", MapHomeToTilde(e.From), MapHomeToTilde(e.To))
+		return err
+	}
+
+	for _, d := range diffs {
+		var err error
+		switch {
+		case d.Unified != "":
+			_, err = io.WriteString(w, d.Unified)
+		case d.Status == DiffAdded && d.Path == ".":
+			_, err = fmt.Fprintf(w, "Only in trash: %s (nothing at %s)\n", MapHomeToTilde(e.To), MapHomeToTilde(e.From))
+		case d.Status == DiffAdded:
+			_, err = fmt.Fprintf(w, "Only in trash: %s\n", d.Path)
+		case d.Status == DiffRemoved:
+			_, err = fmt.Fprintf(w, "Only at %s: %s\n", MapHomeToTilde(e.From), d.Path)
+		default:
+			_, err = fmt.Fprintf(w, "%s: %s\n", d.Path, d.Summary)
+		}
+		if err != nil {
+			return errors.Wrap(err, "write diff")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package lib_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: 元の場所とゴミ箱の中に置いたファイルのエントリ
+func diffEntry(t *testing.T) (lib.HistoryEntry, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	from := filepath.Join(dir, "orig")
+	to := filepath.Join(dir, "trash")
+	return lib.NewHistoryEntry(from, to, lib.RemovedAt{}), from, to
+}
+
+func TestDiffEntry_File(t *testing.T) {
+	e, from, to := diffEntry(t)
+	assert.NoError(t, os.WriteFile(from, []byte("a\nB\nc\n"), 0644))
+	assert.NoError(t, os.WriteFile(to, []byte("a\nb\nc\n"), 0644))
+
+	diffs, err := lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, ".", diffs[0].Path)
+	assert.Equal(t, lib.DiffModified, diffs[0].Status)
+	// 今のファイルからゴミ箱の中のファイルへの差分
+	assert.Contains(t, diffs[0].Unified, "\n-B\n+b\n")
+
+	// 同じ中身なら差分は無い
+	assert.NoError(t, os.WriteFile(from, []byte("a\nb\nc\n"), 0644))
+	diffs, err = lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	var buf bytes.Buffer
+	assert.NoError(t, lib.WriteDiff(&buf, e, diffs))
+	assert.True(t, strings.HasPrefix(buf.String(), "no differences: "))
+
+	// 元の場所に何も無い
+	assert.NoError(t, os.Remove(from))
+	diffs, err = lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+	assert.Equal(t, []lib.FileDiff{{Path: ".", Status: lib.DiffAdded, Summary: "only in trash"}}, diffs)
+}
+
+func TestDiffEntry_NoNewlineAtEnd(t *testing.T) {
+	e, from, to := diffEntry(t)
+	assert.NoError(t, os.WriteFile(from, []byte("a\nb"), 0644))
+	assert.NoError(t, os.WriteFile(to, []byte("a\nc"), 0644))
+
+	diffs, err := lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 1)
+	assert.True(t, strings.HasSuffix(diffs[0].Unified, "\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"), diffs[0].Unified)
+
+	// 末尾の改行の有無だけが違っても差分になる
+	assert.NoError(t, os.WriteFile(from, []byte("a\nb"), 0644))
+	assert.NoError(t, os.WriteFile(to, []byte("a\nb\n"), 0644))
+	diffs, err = lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 1)
+	assert.True(t, strings.HasSuffix(diffs[0].Unified, "\n a\n-b\n\\ No newline at end of file\n+b\n"), diffs[0].Unified)
+}
+
+func TestDiffEntry_Binary(t *testing.T) {
+	e, from, to := diffEntry(t)
+	assert.NoError(t, os.WriteFile(from, []byte{0, 1}, 0644))
+	assert.NoError(t, os.WriteFile(to, []byte{0, 2, 3}, 0644))
+
+	diffs, err := lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 1)
+	assert.True(t, diffs[0].Binary)
+	assert.Empty(t, diffs[0].Unified)
+	assert.Equal(t, "binary files differ (2B → 3B)", diffs[0].Summary)
+}
+
+func TestDiffEntry_Dir(t *testing.T) {
+	e, from, to := diffEntry(t)
+	for path, content := range map[string]string{
+		filepath.Join(from, "same.txt"):        "same",
+		filepath.Join(to, "same.txt"):          "same",
+		filepath.Join(from, "sub", "mod.txt"):  "current\n",
+		filepath.Join(to, "sub", "mod.txt"):    "trashed\n",
+		filepath.Join(from, "new.txt"):         "new",
+		filepath.Join(to, "old.txt"):           "old",
+		filepath.Join(from, "kind"):            "file",
+		filepath.Join(to, "kind", "child.txt"): "dir",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	assert.NoError(t, os.Symlink("a", filepath.Join(from, "link")))
+	assert.NoError(t, os.Symlink("b", filepath.Join(to, "link")))
+
+	diffs, err := lib.DiffEntry(nil, e)
+	assert.NoError(t, err)
+
+	// 名前順に並ぶ
+	status := make([]string, len(diffs))
+	for i, d := range diffs {
+		status[i] = d.Path + " " + string(d.Status)
+	}
+	assert.Equal(t, []string{
+		"kind modified",
+		"link modified",
+		"new.txt removed",
+		"old.txt added",
+		"sub/mod.txt modified",
+	}, status)
+	assert.Equal(t, "file → dir", diffs[0].Summary)
+	assert.Equal(t, "symlink a → b", diffs[1].Summary)
+
+	var buf bytes.Buffer
+	assert.NoError(t, lib.WriteDiff(&buf, e, diffs))
+	out := buf.String()
+	assert.Contains(t, out, "kind: file → dir\n")
+	assert.Contains(t, out, "Only at "+lib.MapHomeToTilde(from)+": new.txt\n")
+	assert.Contains(t, out, "Only in trash: old.txt\n")
+	assert.Contains(t, out, "-current\n+trashed\n")
+}
+
+func TestDiffEntry_MemFileSystem(t *testing.T) {
+	fsys := lib.NewMemFileSystem()
+	e := lib.NewHistoryEntry("/src/dir", "/trash/dir", lib.RemovedAt{})
+	for path, content := range map[string]string{
+		"/src/dir/mod.txt":   "current\n",
+		"/trash/dir/mod.txt": "trashed\n",
+		"/trash/dir/old.txt": "old",
+	} {
+		assert.NoError(t, fsys.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, fsys.WriteFile(path, []byte(content), 0644))
+	}
+
+	// ディスクではなく fsys を比べる
+	diffs, err := lib.DiffEntry(fsys, e)
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 2)
+	assert.Equal(t, "mod.txt", diffs[0].Path)
+	assert.Contains(t, diffs[0].Unified, "-current\n+trashed\n")
+	assert.Equal(t, "old.txt", diffs[1].Path)
+	assert.Equal(t, lib.DiffAdded, diffs[1].Status)
+}
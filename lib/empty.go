@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// EmptyFilter selects the entries to be removed permanently. Zero values don't filter.
+type EmptyFilter struct {
+	// OlderThan selects entries removed more than this long ago.
+	OlderThan time.Duration
+	// LargerThan selects entries larger than this many bytes.
+	LargerThan int64
+	// Pattern is a glob matched against the original path, or its base name if it has no `/`.
+	Pattern string
+	// Batch selects the entries trashed by the invocation with this batch ID.
+	Batch string
+	// FS is where the sizes are read, the OS file system if nil.
+	FS FileSystem
+}
+
+// Select returns the entries which match all the conditions of the filter.
+func (f EmptyFilter) Select(entries HistoryEntries, now time.Time) (HistoryEntries, error) {
+	if f.OlderThan < 0 {
+		return nil, errors.Wrapf(ErrInvalidAge, "older than %v", f.OlderThan)
+	}
+
+	selected := make(HistoryEntries, 0)
+	for _, e := range entries {
+		if f.OlderThan > 0 && now.Sub(e.Removed.Time()) <= f.OlderThan {
+			continue
+		}
+
+		if f.Pattern != "" && !matchGlob(f.Pattern, e.From) {
+			continue
+		}
+
+		if f.Batch != "" && e.BatchID() != f.Batch {
+			continue
+		}
+
+		if f.LargerThan > 0 {
+			size, err := diskUsage(fsOrOS(f.FS), e.To)
+			if err != nil {
+				return nil, err
+			}
+			if size <= f.LargerThan {
+				continue
+			}
+		}
+
+		selected = append(selected, e)
+	}
+	return selected.Sorted(), nil
+}
+
+func matchGlob(pattern, path string) bool {
+	normalized := pattern
+	if strings.ContainsRune(pattern, filepath.Separator) {
+		if p, err := NormalizePath(pattern); err == nil {
+			normalized = p
+		}
+		ok, _ := filepath.Match(normalized, path)
+		return ok
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok
+}
@@ -0,0 +1,159 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"0":     0,
+		"512":   512,
+		"10K":   10 * 1024,
+		"1.5M":  1536 * 1024,
+		"2GB":   2 << 30,
+		"1GiB":  1 << 30,
+		" 3b ":  3,
+		"100mb": 100 << 20,
+	} {
+		got, err := lib.ParseSize(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "K", "-1M", "1X", "-0.5", "NaN", "nanK", "Inf", "+InfG", "-Inf", "1e30", "8192P"} {
+		_, err := lib.ParseSize(in)
+		assert.ErrorIs(t, err, lib.ErrInvalidSize, in)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"12h":  12 * time.Hour,
+		"1.5d": 36 * time.Hour,
+	} {
+		got, err := lib.ParseAge(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "d", "-1d", "3y", "NaNd", "Infd", "+Infw", "-Infd", "1e20d", "2e10w"} {
+		_, err := lib.ParseAge(in)
+		assert.ErrorIs(t, err, lib.ErrInvalidAge, in)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0B", lib.FormatSize(0))
+	assert.Equal(t, "1023B", lib.FormatSize(1023))
+	assert.Equal(t, "1.0K", lib.FormatSize(1024))
+	assert.Equal(t, "1.5M", lib.FormatSize(1536*1024))
+}
+
+// 各条件はすべて満たすものだけが選ばれる
+func TestEmptyFilter_Select(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	small := filepath.Join(dir, "small.txt")
+	large := filepath.Join(dir, "large.log")
+	assert.NoError(t, os.WriteFile(small, []byte("x"), 0644))
+	assert.NoError(t, os.WriteFile(large, make([]byte, 4096), 0644))
+
+	oldSmall := lib.NewHistoryEntry("/home/user/small.txt", small, lib.RemovedAt(now.Add(-40*24*time.Hour)))
+	newLarge := lib.NewHistoryEntry("/home/user/logs/large.log", large, lib.RemovedAt(now.Add(-time.Hour)))
+	entries := lib.HistoryEntries{newLarge, oldSmall}
+
+	got, err := lib.EmptyFilter{}.Select(entries, now)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryEntries{oldSmall, newLarge}, got)
+
+	got, err = lib.EmptyFilter{OlderThan: 30 * 24 * time.Hour}.Select(entries, now)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryEntries{oldSmall}, got)
+
+	got, err = lib.EmptyFilter{LargerThan: 1024}.Select(entries, now)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryEntries{newLarge}, got)
+
+	got, err = lib.EmptyFilter{Pattern: "*.log"}.Select(entries, now)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryEntries{newLarge}, got)
+
+	got, err = lib.EmptyFilter{Pattern: "/home/user/*", LargerThan: 1024}.Select(entries, now)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+
+	// バッチ ID の無い古いエントリはどのバッチにも含まれない
+	batched := newLarge
+	batched.Metadata = &lib.Metadata{Batch: lib.Batch{ID: "1a2b3c4d"}}
+	got, err = lib.EmptyFilter{Batch: "1a2b3c4d"}.Select(lib.HistoryEntries{batched, oldSmall}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryEntries{batched}, got)
+
+	// 負の期間で全部を選んだりしない
+	_, err = lib.EmptyFilter{OlderThan: -time.Hour}.Select(entries, now)
+	assert.ErrorIs(t, err, lib.ErrInvalidAge)
+}
+
+// Purge でファイルが削除され、履歴からも消える
+func TestHistoryTrash_Purge(t *testing.T) {
+	trashDir := t.TempDir()
+	trash := lib.NewHistoryTrash(trashDir)
+	srcDir := t.TempDir()
+
+	src1 := filepath.Join(srcDir, "a.txt")
+	src2 := filepath.Join(srcDir, "dir", "b.txt")
+	createDummyFile(t, src1)
+	createDummyFile(t, src2)
+	// 書き込み禁止のディレクトリも削除できる
+	assert.NoError(t, os.Chmod(filepath.Dir(src2), 0500))
+
+	_, err := trash.Put([]string{src1, filepath.Dir(src2)}, false)
+	assert.NoError(t, err)
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	purged, err := trash.Purge(entries)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, entries, purged)
+	for _, e := range entries {
+		assert.NoFileExists(t, e.To)
+		assert.NoDirExists(t, e.To)
+	}
+
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Empty(t, history.Entries)
+}
+
+func TestFreedesktopTrash_Purge(t *testing.T) {
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+	src := filepath.Join(t.TempDir(), "file.txt")
+	createDummyFile(t, src)
+
+	_, err := trash.Put([]string{src}, false)
+	assert.NoError(t, err)
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+
+	purged, err := trash.Purge(entries)
+	assert.NoError(t, err)
+	assert.Len(t, purged, 1)
+	assert.NoFileExists(t, filepath.Join(trash.FilesDir(), "file.txt"))
+	assert.NoFileExists(t, filepath.Join(trash.InfoDir(), "file.txt.trashinfo"))
+
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
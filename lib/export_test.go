@@ -0,0 +1,24 @@
+package lib
+
+import tea "github.com/charmbracelet/bubbletea"
+
+var FindVolumeTrash = findVolumeTrash
+
+var (
+	MoveFile   = func(from, to string) error { return moveFile(OSFileSystem{}, from, to) }
+	CopyTree   = copyTree
+	VerifyTree = verifyTree
+	Atime      = atime
+)
+
+// NewModel is the restore UI, driven by the tests with Update.
+func NewModel(trash Trash, entries HistoryEntries, opts RestoreOptions) tea.Model {
+	return newModel(trash, entries, opts)
+}
+
+// Marked returns the entries marked in the restore UI.
+func Marked(m tea.Model) HistoryEntries {
+	return m.(model).marked()
+}
+
+var HasHistory = hasHistory
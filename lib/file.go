@@ -2,9 +2,11 @@ package lib
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -13,7 +15,41 @@ import (
 
 const DuplicatedTimeFormat = "20060102T150405Z0700"
 
-type FileError error
+// FileError is the failure to move one file from From to To.
+type FileError struct {
+	From string
+	To   string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.From, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileErrors returns the failures of each file in err, which may join several of them.
+func FileErrors(err error) []*FileError {
+	found := make([]*FileError, 0)
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case *FileError:
+			found = append(found, e)
+		case interface{ Unwrap() []error }:
+			for _, cause := range e.Unwrap() {
+				walk(cause)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+	return found
+}
 
 var (
 	ErrFileNotFound = errors.New("file not found")
@@ -21,14 +57,18 @@ var (
 )
 
 type ToBeMovedFile struct {
-	From string
-	To   string
+	From     string
+	To       string
+	Metadata *Metadata
 }
 
 type MovedFile struct {
-	From    string
-	To      string
-	MovedAt time.Time
+	From     string
+	To       string
+	MovedAt  time.Time
+	Metadata *Metadata
+	// Leftover is why what is left of the source could not be removed after the file was copied, nil if nothing is left.
+	Leftover error
 }
 
 func NewToBeMovedFile(from, to string) ToBeMovedFile {
@@ -49,48 +89,107 @@ func NewMovedFile(from, to string, movedAt time.Time) MovedFile {
 type ToBeMovedFiles []ToBeMovedFile
 
 func (files ToBeMovedFiles) Move(isDryRun bool) ([]MovedFile, error) {
-	movedFiles := make([]MovedFile, len(files))
-	invalidPaths := make([]string, 0)
+	now := time.Now()
+	fsys := OSFileSystem{}
+	return files.resolve(fsys, now).withMetadata(fsys, NewBatch()).moveEach(fsys, isDryRun, now, nil)
+}
+
+// resolve decides the final destination of each file, so that it can be recorded before moving.
+func (files ToBeMovedFiles) resolve(fsys FileSystem, now time.Time) ToBeMovedFiles {
 	uniqueFiles := resolveDuplicatesWithIndexSuffix(files)
 
-	var eg errgroup.Group
+	resolved := make(ToBeMovedFiles, len(uniqueFiles))
 	for i, f := range uniqueFiles {
-		eg.Go(func() error {
-			now := time.Now()
-			from := f.From
-			to, err := resolveDuplicateFilenameWithTimestamp(f.To, now)
-			if err != nil {
-				invalidPaths = append(invalidPaths, to)
-				return errors.Wrap(err, "resolveDuplicateFilenameWithTimestamp")
-			}
+		resolved[i] = NewToBeMovedFile(f.From, resolveDuplicateFilenameWithTimestamp(fsys, f.To, now))
+	}
+	return resolved
+}
 
-			if isDryRun {
-				movedFiles[i] = NewMovedFile(from, to, now)
-				return nil
-			}
+// withMetadata collects the metadata of each file before it's moved.
+func (files ToBeMovedFiles) withMetadata(fsys FileSystem, batch Batch) ToBeMovedFiles {
+	collected := make(ToBeMovedFiles, len(files))
+	for i, f := range files {
+		collected[i] = f
+		collected[i].Metadata = collectMetadata(fsys, f.From, batch)
+	}
+	return collected
+}
 
-			// mkdirs
-			if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
-				invalidPaths = append(invalidPaths, to)
-				return errors.Wrap(err, "mkdirall")
-			}
+// moveEach moves the resolved files and calls onMoved as soon as each file has been moved.
+// On failure, the files which have been moved are returned together with a FileError for each file which has not.
+func (files ToBeMovedFiles) moveEach(fsys FileSystem, isDryRun bool, now time.Time, onMoved func(MovedFile) error) ([]MovedFile, error) {
+	var (
+		mu           sync.Mutex
+		moved        = make([]bool, len(files))
+		movedFiles   = make([]MovedFile, len(files))
+		invalidPaths = make([]string, 0)
+		errs         = make([]error, 0)
+	)
+
+	fail := func(f ToBeMovedFile, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		invalidPaths = append(invalidPaths, f.To)
+		errs = append(errs, &FileError{From: f.From, To: f.To, Err: err})
+		return err
+	}
 
-			// rename file
-			if err := os.Rename(from, to); err != nil {
-				invalidPaths = append(invalidPaths, to)
-				return errors.Wrap(err, "os.rename")
+	var eg errgroup.Group
+	for i, f := range files {
+		eg.Go(func() error {
+			from, to := f.From, f.To
+			var leftover error
+
+			if !isDryRun {
+				// mkdirs
+				if err := fsys.MkdirAll(filepath.Dir(to), 0777); err != nil {
+					return fail(f, errors.Wrap(err, "mkdirall"))
+				}
+
+				// rename file, or copy it across filesystems
+				if err := moveFile(fsys, from, to); err != nil {
+					// the complete copy is the file now, which must be recorded
+					if !errors.Is(err, ErrSourceLeftOver) {
+						return fail(f, errors.Wrap(err, "move file"))
+					}
+					log.Printf("%v has been moved to %v, but the source is left: %v", from, to, err)
+					leftover = err
+				}
 			}
 
+			mu.Lock()
+			defer mu.Unlock()
 			movedFiles[i] = NewMovedFile(from, to, now)
+			movedFiles[i].Metadata = f.Metadata
+			movedFiles[i].Leftover = leftover
+			moved[i] = true
+			if onMoved != nil {
+				if err := onMoved(movedFiles[i]); err != nil {
+					err = errors.Wrap(err, "on moved")
+					invalidPaths = append(invalidPaths, to)
+					errs = append(errs, &FileError{From: from, To: to, Err: err})
+					return err
+				}
+			}
 			return nil
 		})
 	}
 
-	if err := eg.Wait(); err != nil {
-		return nil, errors.Wrapf(err, "failed to remove files: %v", invalidPaths)
+	// every failure rather than the first one
+	_ = eg.Wait()
+
+	result := make([]MovedFile, 0, len(files))
+	for i, f := range movedFiles {
+		if moved[i] {
+			result = append(result, f)
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, errors.Wrapf(errors.Join(errs...), "failed to remove files: %v", invalidPaths)
 	}
 
-	return movedFiles, nil
+	return result, nil
 }
 
 func resolveDuplicatesWithIndexSuffix(files []ToBeMovedFile) []ToBeMovedFile {
@@ -118,13 +217,12 @@ func resolveDuplicatesWithIndexSuffix(files []ToBeMovedFile) []ToBeMovedFile {
 	return unique
 }
 
-func resolveDuplicateFilenameWithTimestamp(path string, now time.Time) (string, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return path, nil
+func resolveDuplicateFilenameWithTimestamp(fsys FileSystem, path string, now time.Time) string {
+	if _, err := fsys.Lstat(path); os.IsNotExist(err) {
+		return path
 	}
 
 	ext := filepath.Ext(path)
 	base := strings.TrimSuffix(path, ext)
-	newPath := fmt.Sprintf("%s.%s%s", base, now.Format(DuplicatedTimeFormat), ext)
-	return newPath, nil
+	return fmt.Sprintf("%s.%s%s", base, now.Format(DuplicatedTimeFormat), ext)
 }
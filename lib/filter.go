@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+// The prefixes of the filter chips.
+const (
+	ChipSince = "since:"
+	ChipUntil = "until:"
+	ChipIn    = "in:"
+)
+
+// Filter selects the entries shown in the restore UI.
+type Filter struct {
+	// Pattern is the words which must all fuzzy match the original path, the path in trash or the ID.
+	Pattern string
+	Chips   []FilterChip
+}
+
+// FilterChip narrows the entries down by removal time or directory.
+type FilterChip struct {
+	// Token is the chip as typed, such as `since:7d` or `in:~/src`.
+	Token string
+	query HistoryQuery
+}
+
+func (c FilterChip) String() string {
+	return "[" + c.Token + "]"
+}
+
+// ParseFilterChip parses a token such as `since:7d`, `until:2024-01-01` or `in:~/src`.
+// ok is false if token is not a chip, and the error is set if it looks like one but is invalid.
+func ParseFilterChip(token string, now time.Time) (chip FilterChip, ok bool, err error) {
+	chip.Token = token
+	switch {
+	case strings.HasPrefix(token, ChipSince), strings.HasPrefix(token, ChipUntil):
+		key, value, _ := strings.Cut(token, ":")
+		t, err := ParseTime(value, now)
+		if err != nil {
+			return FilterChip{}, true, err
+		}
+		if key+":" == ChipSince {
+			chip.query.Since = t
+		} else {
+			chip.query.Until = t
+		}
+
+	case strings.HasPrefix(token, ChipIn):
+		value := strings.TrimPrefix(token, ChipIn)
+		if value == "" {
+			return FilterChip{}, true, errors.Wrapf(ErrInvalidFilter, "%q needs a directory", token)
+		}
+		dir, err := NormalizePath(value)
+		if err != nil {
+			return FilterChip{}, true, errors.Wrapf(ErrInvalidFilter, "%q: %v", token, err)
+		}
+		chip.query.FromPrefix = dir
+
+	default:
+		return FilterChip{}, false, nil
+	}
+	return chip, true, nil
+}
+
+// IsZero is true if the filter selects everything.
+func (f Filter) IsZero() bool {
+	return strings.TrimSpace(f.Pattern) == "" && len(f.Chips) == 0
+}
+
+func (f Filter) Match(e HistoryEntry) bool {
+	for _, c := range f.Chips {
+		if !c.query.Match(e) {
+			return false
+		}
+	}
+
+	for _, word := range strings.Fields(f.Pattern) {
+		if !FuzzyMatch(word, MapHomeToTilde(e.From)) && !FuzzyMatch(word, MapHomeToTilde(e.To)) && !FuzzyMatch(word, e.ID()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the entries matching the filter, in the same order.
+func (f Filter) Apply(entries HistoryEntries) HistoryEntries {
+	if f.IsZero() {
+		return entries
+	}
+	matched := make(HistoryEntries, 0, len(entries))
+	for _, e := range entries {
+		if f.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+func (f Filter) String() string {
+	chips := make([]string, len(f.Chips))
+	for i, c := range f.Chips {
+		chips[i] = c.String()
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", strings.Join(chips, " "), f.Pattern))
+}
+
+// FuzzyMatch reports whether the characters of pattern appear in s in order, not necessarily next to each other.
+// It ignores case unless pattern has an upper case letter.
+func FuzzyMatch(pattern, s string) bool {
+	if !hasUpper(pattern) {
+		s = strings.ToLower(s)
+	}
+
+	rest := s
+	for _, r := range pattern {
+		i := strings.IndexRune(rest, r)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(string(r)):]
+	}
+	return true
+}
+
+func hasUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
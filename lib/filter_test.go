@@ -0,0 +1,113 @@
+package lib_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "anything", true},
+		{"mgo", "/home/user/src/main.go", true},
+		{"srcmain", "/home/user/src/main.go", true},
+		{"gom", "/home/user/src/main.go", false},
+		// 小文字だけなら大文字小文字を区別しない
+		{"readme", "/home/user/README.md", true},
+		// 大文字があれば区別する
+		{"Readme", "/home/user/README.md", false},
+		{"READ", "/home/user/README.md", true},
+		{"ファイル", "/home/user/日本語のファイル.txt", true},
+	} {
+		assert.Equal(t, tt.want, lib.FuzzyMatch(tt.pattern, tt.s), "%q in %q", tt.pattern, tt.s)
+	}
+}
+
+func TestParseFilterChip(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	chip, ok, err := lib.ParseFilterChip("since:7d", now)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "[since:7d]", chip.String())
+
+	_, ok, err = lib.ParseFilterChip("until:2024-01-01", now)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, ok, err = lib.ParseFilterChip("in:~/src", now)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// チップでない単語
+	_, ok, err = lib.ParseFilterChip("main.go", now)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// チップの形で値が不正
+	_, ok, err = lib.ParseFilterChip("since:someday", now)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, lib.ErrInvalidTime)
+	_, ok, err = lib.ParseFilterChip("in:", now)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, lib.ErrInvalidFilter)
+}
+
+func TestFilter_Apply(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	now := time.Now()
+	at := func(daysAgo int) lib.RemovedAt {
+		return lib.RemovedAt(now.Add(-time.Duration(daysAgo) * 24 * time.Hour))
+	}
+	entries := lib.HistoryEntries{
+		lib.NewHistoryEntry(filepath.Join(home, "src", "main.go"), "/trash/main.go", at(10)),
+		lib.NewHistoryEntry(filepath.Join(home, "src", "util.go"), "/trash/util.go", at(1)),
+		lib.NewHistoryEntry(filepath.Join(home, "doc", "main.md"), "/trash/main.md", at(1)),
+		lib.NewHistoryEntry(filepath.Join(home, "src2", "x.go"), "/trash/x.go", at(1)),
+	}
+	chip := func(token string) lib.FilterChip {
+		t.Helper()
+		c, ok, err := lib.ParseFilterChip(token, now)
+		assert.True(t, ok)
+		assert.NoError(t, err)
+		return c
+	}
+	tos := func(f lib.Filter) []string {
+		matched := f.Apply(entries)
+		paths := make([]string, len(matched))
+		for i, e := range matched {
+			paths[i] = filepath.Base(e.To)
+		}
+		return paths
+	}
+
+	assert.True(t, lib.Filter{Pattern: " "}.IsZero())
+	assert.Len(t, tos(lib.Filter{}), 4)
+	// 単語はすべて元のパスかゴミ箱のパスにマッチする
+	assert.Equal(t, []string{"main.go", "main.md"}, tos(lib.Filter{Pattern: "main"}))
+	assert.Equal(t, []string{"main.go"}, tos(lib.Filter{Pattern: "main .go"}))
+	// ~ は home
+	assert.Equal(t, []string{"main.md"}, tos(lib.Filter{Pattern: "~/doc"}))
+	// ID でも絞り込める
+	assert.Equal(t, []string{"util.go"}, tos(lib.Filter{Pattern: entries[1].ID()}))
+
+	assert.Equal(t, []string{"util.go", "main.md", "x.go"}, tos(lib.Filter{Chips: []lib.FilterChip{chip("since:2d")}}))
+	assert.Equal(t, []string{"main.go"}, tos(lib.Filter{Chips: []lib.FilterChip{chip("until:2d")}}))
+	// ディレクトリは src2 を含まない
+	assert.Equal(t, []string{"main.go", "util.go"}, tos(lib.Filter{Chips: []lib.FilterChip{chip("in:~/src")}}))
+	assert.Equal(t, []string{"util.go"}, tos(lib.Filter{
+		Pattern: "go",
+		Chips:   []lib.FilterChip{chip("in:~/src"), chip("since:2d")},
+	}))
+
+	// 相対パスは今のディレクトリから
+	t.Chdir(home)
+	assert.Equal(t, []string{"main.md"}, tos(lib.Filter{Chips: []lib.FilterChip{chip("in:doc")}}))
+}
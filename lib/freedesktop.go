@@ -0,0 +1,601 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// FreeDesktop.org Trash specification
+// ref: https://specifications.freedesktop.org/trash-spec/latest/
+const (
+	TrashInfoExt       = ".trashinfo"
+	TrashInfoHeader    = "[Trash Info]"
+	DeletionDateFormat = "2006-01-02T15:04:05"
+)
+
+var (
+	ErrTrashInfoInvalid = errors.New("trashinfo is invalid")
+)
+
+// TrashInfo is the content of `info/<name>.trashinfo`.
+type TrashInfo struct {
+	Path         string
+	DeletionDate time.Time
+}
+
+func NewTrashInfo(path string, deletionDate time.Time) TrashInfo {
+	return TrashInfo{
+		Path:         path,
+		DeletionDate: deletionDate,
+	}
+}
+
+func (i TrashInfo) String() string {
+	var b strings.Builder
+	b.WriteString(TrashInfoHeader + "\n")
+	b.WriteString("Path=" + EscapeTrashInfoPath(i.Path) + "\n")
+	b.WriteString("DeletionDate=" + i.DeletionDate.Local().Format(DeletionDateFormat) + "\n")
+	return b.String()
+}
+
+func ParseTrashInfo(r io.Reader) (TrashInfo, error) {
+	var (
+		info      TrashInfo
+		inGroup   bool
+		foundPath bool
+		foundDate bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// group header
+		if strings.HasPrefix(line, "[") {
+			inGroup = line == TrashInfoHeader
+			continue
+		}
+		if !inGroup {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "Path":
+			path, err := UnescapeTrashInfoPath(strings.TrimSpace(value))
+			if err != nil {
+				return TrashInfo{}, errors.Wrap(errors.Join(err, ErrTrashInfoInvalid), "unescape path")
+			}
+			info.Path = path
+			foundPath = true
+		case "DeletionDate":
+			t, err := time.ParseInLocation(DeletionDateFormat, strings.TrimSpace(value), time.Local)
+			if err != nil {
+				return TrashInfo{}, errors.Wrap(errors.Join(err, ErrTrashInfoInvalid), "parse deletion date")
+			}
+			info.DeletionDate = t
+			foundDate = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return TrashInfo{}, errors.Wrap(err, "failed to scan trashinfo")
+	}
+	if !foundPath || !foundDate {
+		return TrashInfo{}, errors.Wrap(ErrTrashInfoInvalid, "missing Path or DeletionDate")
+	}
+
+	return info, nil
+}
+
+// EscapeTrashInfoPath escapes path like URLs as required by the spec.
+// Only unreserved characters and '/' are kept as is.
+func EscapeTrashInfoPath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if isUnreservedPathByte(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func UnescapeTrashInfoPath(path string) (string, error) {
+	return url.PathUnescape(path)
+}
+
+func isUnreservedPathByte(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	switch c {
+	case '-', '_', '.', '~', '/':
+		return true
+	}
+	return false
+}
+
+func DefaultFreedesktopTrashDir() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(Home(), ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash")
+}
+
+var _ Trash = (*FreedesktopTrash)(nil)
+
+// FreedesktopTrash stores removed files in `files/` and their origin in `info/`,
+// so they can be seen by other trash implementations (Nautilus, Dolphin, gio, trash-cli, ...).
+type FreedesktopTrash struct {
+	Dir string
+	// Top is the top directory of the volume for per-volume trashes, empty for the home trash.
+	Top string
+	// LockTimeout is how long Purge waits for other processes purging the same trash.
+	LockTimeout time.Duration
+	// FS is where the files are moved, the OS file system if nil. The info files and the lock stay on disk.
+	FS FileSystem
+}
+
+// OrphanInfoGracePeriod is how old an info file without its file must be to be removed.
+// Writers create the info before moving the file, so a newer one may belong to a file being trashed.
+const OrphanInfoGracePeriod = time.Hour
+
+func NewFreedesktopTrash(dir string) *FreedesktopTrash {
+	return &FreedesktopTrash{
+		Dir:         dir,
+		LockTimeout: DefaultLockTimeout,
+	}
+}
+
+// at returns the trash in dir with the same settings as t.
+func (t *FreedesktopTrash) at(dir, top string) *FreedesktopTrash {
+	trash := *t
+	trash.Dir = dir
+	trash.Top = top
+	return &trash
+}
+
+func (t *FreedesktopTrash) FilesDir() string {
+	return filepath.Join(t.Dir, "files")
+}
+
+func (t *FreedesktopTrash) InfoDir() string {
+	return filepath.Join(t.Dir, "info")
+}
+
+func (t *FreedesktopTrash) infoPath(name string) string {
+	return filepath.Join(t.InfoDir(), name+TrashInfoExt)
+}
+
+func (t *FreedesktopTrash) Put(paths []string, isDryRun bool) ([]MovedFile, error) {
+	froms := make([]string, len(paths))
+	for i, path := range paths {
+		from, err := validatePath(fsOrOS(t.FS), path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to validate path")
+		}
+		froms[i] = from
+	}
+
+	movedFiles := make([]MovedFile, 0, len(froms))
+	reserved := make(map[string]struct{}, len(froms))
+	// one deletion date for the invocation, by which undo groups the entries
+	now := time.Now()
+	for _, from := range froms {
+		vt, err := trashFor(t.Dir, from, !isDryRun)
+		if err != nil {
+			return movedFiles, errors.Wrap(err, "failed to find trash")
+		}
+		trash := t
+		if vt.Top != "" {
+			trash = t.at(vt.Dir, vt.Top)
+		}
+
+		if isDryRun {
+			to := filepath.Join(trash.FilesDir(), trash.freeName(filepath.Base(from), reserved))
+			reserved[to] = struct{}{}
+			movedFiles = append(movedFiles, NewMovedFile(from, to, now))
+			continue
+		}
+
+		moved, err := trash.put(from, now)
+		if err != nil {
+			return movedFiles, err
+		}
+		movedFiles = append(movedFiles, moved)
+	}
+
+	return movedFiles, nil
+}
+
+func (t *FreedesktopTrash) put(from string, now time.Time) (MovedFile, error) {
+	fsys := fsOrOS(t.FS)
+	if err := fsys.MkdirAll(t.FilesDir(), 0700); err != nil {
+		return MovedFile{}, errors.Wrap(err, "mkdirall")
+	}
+	if err := os.MkdirAll(t.InfoDir(), 0700); err != nil {
+		return MovedFile{}, errors.Wrap(err, "mkdirall")
+	}
+
+	// per-volume trashes store the path relative to the top directory
+	path := from
+	if t.Top != "" {
+		if rel, err := filepath.Rel(t.Top, from); err == nil {
+			path = rel
+		}
+	}
+
+	name, err := t.reserve(filepath.Base(from), NewTrashInfo(path, now))
+	if err != nil {
+		return MovedFile{}, errors.Wrapf(err, "failed to reserve trashinfo: %v", from)
+	}
+
+	to := filepath.Join(t.FilesDir(), name)
+	moved := NewMovedFile(from, to, now)
+	if err := moveFile(fsys, from, to); err != nil {
+		if !errors.Is(err, ErrSourceLeftOver) {
+			// the file is not in the trash, so the info must not be either
+			_ = os.Remove(t.infoPath(name))
+			return MovedFile{}, errors.Wrapf(err, "move file: %v", from)
+		}
+		log.Printf("%v has been moved to %v, but the source is left: %v", from, to, err)
+		moved.Leftover = err
+	}
+
+	return moved, nil
+}
+
+// reserve atomically creates the info file for a name which is free in both `files/` and `info/`.
+func (t *FreedesktopTrash) reserve(base string, info TrashInfo) (string, error) {
+	for n := 1; ; n++ {
+		name := indexedName(base, n)
+
+		f, err := os.OpenFile(t.infoPath(name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return "", errors.Wrap(err, "create trashinfo")
+		}
+
+		// a stray file without info can still occupy the name
+		if t.hasFile(name) {
+			f.Close()
+			_ = os.Remove(f.Name())
+			continue
+		}
+
+		if _, err := f.WriteString(info.String()); err != nil {
+			f.Close()
+			_ = os.Remove(f.Name())
+			return "", errors.Wrap(err, "write trashinfo")
+		}
+		if err := f.Close(); err != nil {
+			_ = os.Remove(f.Name())
+			return "", errors.Wrap(err, "close trashinfo")
+		}
+
+		return name, nil
+	}
+}
+
+// freeName returns the name which reserve would choose, without creating anything.
+func (t *FreedesktopTrash) freeName(base string, reserved map[string]struct{}) string {
+	for n := 1; ; n++ {
+		name := indexedName(base, n)
+		if _, ok := reserved[filepath.Join(t.FilesDir(), name)]; ok {
+			continue
+		}
+		if _, err := os.Lstat(t.infoPath(name)); err == nil {
+			continue
+		}
+		if t.hasFile(name) {
+			continue
+		}
+		return name
+	}
+}
+
+func (t *FreedesktopTrash) hasFile(name string) bool {
+	_, err := fsOrOS(t.FS).Lstat(filepath.Join(t.FilesDir(), name))
+	return err == nil
+}
+
+// indexedName returns base for n == 1, otherwise inserts `.n` before the extension (e.g. `foo.2.txt`).
+func indexedName(base string, n int) string {
+	if n == 1 {
+		return base
+	}
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	return fmt.Sprintf("%s.%d%s", name, n, ext)
+}
+
+func (t *FreedesktopTrash) Entries() (HistoryEntries, error) {
+	entries, err := t.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	// the home trash also lists the trashes of the other volumes
+	if t.Top == "" {
+		for _, vt := range VolumeTrashes(t.Dir) {
+			volumeEntries, err := t.at(vt.Dir, vt.Top).entries()
+			if err != nil {
+				log.Printf("failed to read %v: %v", vt.Dir, err)
+				continue
+			}
+			entries = append(entries, volumeEntries...)
+		}
+	}
+
+	return entries, nil
+}
+
+// Query reads all the info files since they have no index.
+func (t *FreedesktopTrash) Query(q HistoryQuery) (HistoryEntries, error) {
+	entries, err := t.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make(HistoryEntries, 0, len(entries))
+	for _, e := range entries {
+		if q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+func (t *FreedesktopTrash) entries() (HistoryEntries, error) {
+	dirEntries, err := os.ReadDir(t.InfoDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read info dir")
+	}
+
+	entries := make(HistoryEntries, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), TrashInfoExt) {
+			continue
+		}
+
+		name := strings.TrimSuffix(d.Name(), TrashInfoExt)
+		to := filepath.Join(t.FilesDir(), name)
+
+		if _, err := fsOrOS(t.FS).Lstat(to); err != nil {
+			if os.IsNotExist(err) {
+				// restored by someone, or still being moved in by a writer.
+				// Purge removes the info once it's old enough.
+				log.Printf("skip trashinfo without its file: %v", d.Name())
+				continue
+			}
+			return nil, errors.Wrap(err, "failed to check file existence")
+		}
+
+		info, err := t.readInfo(name)
+		if err != nil {
+			// skip invalid info files
+			log.Println(err)
+			continue
+		}
+
+		from := info.Path
+		if !filepath.IsAbs(from) {
+			// relative paths are relative to the top directory of the volume
+			from = filepath.Join(t.top(), from)
+		}
+
+		entries = append(entries, NewHistoryEntry(from, to, RemovedAt(info.DeletionDate)))
+	}
+
+	return entries, nil
+}
+
+func (t *FreedesktopTrash) top() string {
+	if t.Top != "" {
+		return t.Top
+	}
+	return filepath.Dir(t.Dir)
+}
+
+// RecordRestored removes the info files of the restored entries, so that other implementations
+// don't list them anymore, and keeps the restore log next to `files/` and `info/`, where they don't look.
+func (t *FreedesktopTrash) RecordRestored(entries []RestoredEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	restored := make(HistoryEntries, len(entries))
+	for i, e := range entries {
+		restored[i] = e.HistoryEntry
+	}
+	dirs, byDir, errs := t.byTrashDir(restored)
+	for _, dir := range dirs {
+		trash := t.at(dir, "")
+		err := trash.withLock(func() error {
+			return trash.removeInfo(byDir[dir])
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := appendRestoreLog(t.Dir, entries); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// removeInfo removes the info files of the entries whose file has left the trash.
+// The caller must hold the lock of t.
+func (t *FreedesktopTrash) removeInfo(entries HistoryEntries) error {
+	var errs []error
+	for _, e := range entries {
+		name := filepath.Base(e.To)
+		if t.hasFile(name) {
+			continue
+		}
+		if err := os.Remove(t.infoPath(name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Wrapf(err, "remove trashinfo of %v", e.To))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// byTrashDir groups the entries by the trash dir they are in, in the order of the entries.
+func (t *FreedesktopTrash) byTrashDir(entries HistoryEntries) ([]string, map[string]HistoryEntries, []error) {
+	// `<trash>/files/<name>` has its info at `<trash>/info/<name>.trashinfo`
+	dirs := make([]string, 0)
+	byDir := make(map[string]HistoryEntries)
+	var errs []error
+	for _, e := range entries {
+		dir := filepath.Dir(filepath.Dir(e.To))
+		if filepath.Dir(e.To) != t.at(dir, "").FilesDir() {
+			errs = append(errs, errors.Newf("not in a trash: %v", e.To))
+			continue
+		}
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], e)
+	}
+	return dirs, byDir, errs
+}
+
+// Purge removes the files first, so that a crash leaves only an orphan info which is dropped later.
+// It also removes the orphan info files of the trashes it touches, including t even if entries is empty.
+func (t *FreedesktopTrash) Purge(entries HistoryEntries) (HistoryEntries, error) {
+	dirs, byDir, errs := t.byTrashDir(entries)
+	if _, err := os.Stat(t.Dir); err == nil && !slices.Contains(dirs, t.Dir) {
+		dirs = append([]string{t.Dir}, dirs...)
+	}
+
+	purged := make(HistoryEntries, 0, len(entries))
+	now := time.Now()
+	for _, dir := range dirs {
+		trash := t.at(dir, "")
+		err := trash.withLock(func() error {
+			removed, err := trash.purge(byDir[dir])
+			purged = append(purged, removed...)
+			return errors.Join(err, trash.removeOrphanInfo(now))
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// purge removes the entries, which are all in t. The caller must hold the lock of t.
+func (t *FreedesktopTrash) purge(entries HistoryEntries) (HistoryEntries, error) {
+	purged := make(HistoryEntries, 0, len(entries))
+	var errs []error
+	for _, e := range entries {
+		if err := fsOrOS(t.FS).RemoveAll(e.To); err != nil {
+			errs = append(errs, errors.Wrapf(err, "remove %v", e.To))
+			continue
+		}
+		if err := os.Remove(t.infoPath(filepath.Base(e.To))); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Wrapf(err, "remove trashinfo of %v", e.To))
+		}
+		purged = append(purged, e)
+	}
+	return purged, errors.Join(errs...)
+}
+
+// removeOrphanInfo removes the info files whose file is gone, such as restored by another tool,
+// once they are older than OrphanInfoGracePeriod. The caller must hold the lock of t.
+func (t *FreedesktopTrash) removeOrphanInfo(now time.Time) error {
+	dirEntries, err := os.ReadDir(t.InfoDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "read info dir")
+	}
+
+	for _, d := range dirEntries {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), TrashInfoExt) {
+			continue
+		}
+		name := strings.TrimSuffix(d.Name(), TrashInfoExt)
+		if _, err := fsOrOS(t.FS).Lstat(filepath.Join(t.FilesDir(), name)); !os.IsNotExist(err) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil || now.Sub(info.ModTime()) < OrphanInfoGracePeriod {
+			// the file may be being moved in
+			continue
+		}
+
+		log.Printf("remove orphan trashinfo: %v", d.Name())
+		if err := os.Remove(t.infoPath(name)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "remove orphan trashinfo %v", d.Name())
+		}
+	}
+	return nil
+}
+
+// withLock runs fn while holding the lock of t, so that purges don't race each other.
+func (t *FreedesktopTrash) withLock(fn func() error) error {
+	lock, err := LockTrashDir(t.Dir, t.LockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock trash")
+	}
+	if err := fn(); err != nil {
+		_ = lock.Release()
+		return err
+	}
+	return lock.Release()
+}
+
+// Pin is not supported since the spec has no place for it, and there is no quota to protect from either.
+func (t *FreedesktopTrash) Pin(entries HistoryEntries, pinned bool) error {
+	return errors.Wrapf(ErrPinUnsupported, "backend: %v", BackendFreedesktop)
+}
+
+// Migrate has nothing to do since the format is defined by the spec.
+func (t *FreedesktopTrash) Migrate(isDryRun bool) ([]Migration, error) {
+	return nil, nil
+}
+
+func (t *FreedesktopTrash) readInfo(name string) (TrashInfo, error) {
+	f, err := os.Open(t.infoPath(name))
+	if err != nil {
+		return TrashInfo{}, errors.Wrap(err, "open trashinfo")
+	}
+	defer f.Close()
+
+	info, err := ParseTrashInfo(f)
+	if err != nil {
+		return TrashInfo{}, errors.Wrapf(err, "parse trashinfo: %v", name)
+	}
+	return info, nil
+}
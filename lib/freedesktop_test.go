@@ -0,0 +1,187 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// trashinfo の書き出しと読み込みが往復できる（パスは URL エンコードされる）
+func TestTrashInfo_RoundTrip(t *testing.T) {
+	deletedAt := time.Date(2023, 10, 1, 12, 34, 56, 0, time.Local)
+	info := lib.NewTrashInfo("/home/user/a b%c/日本語.txt", deletedAt)
+
+	text := info.String()
+	assert.Contains(t, text, "[Trash Info]\n")
+	assert.Contains(t, text, "Path=/home/user/a%20b%25c/%E6%97%A5%E6%9C%AC%E8%AA%9E.txt\n")
+	assert.Contains(t, text, "DeletionDate=2023-10-01T12:34:56\n")
+
+	parsed, err := lib.ParseTrashInfo(strings.NewReader(text))
+	assert.NoError(t, err)
+	assert.Equal(t, info.Path, parsed.Path)
+	assert.True(t, deletedAt.Equal(parsed.DeletionDate))
+}
+
+// 必須キーが欠けた trashinfo はエラーになる
+func TestParseTrashInfo_Invalid(t *testing.T) {
+	_, err := lib.ParseTrashInfo(strings.NewReader("[Trash Info]\nPath=/tmp/foo\n"))
+	assert.ErrorIs(t, err, lib.ErrTrashInfoInvalid)
+
+	// 別グループのキーは無視される
+	_, err = lib.ParseTrashInfo(strings.NewReader("[Other]\nPath=/tmp/foo\nDeletionDate=2023-10-01T12:34:56\n"))
+	assert.ErrorIs(t, err, lib.ErrTrashInfoInvalid)
+}
+
+// Put したファイルが files/ と info/ に格納され、Entries で読み戻せる
+func TestFreedesktopTrash_PutAndEntries(t *testing.T) {
+	srcDir := t.TempDir()
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+
+	// 同名のファイルを2つ用意して名前の衝突を起こす
+	src1 := filepath.Join(srcDir, "a", "file.txt")
+	src2 := filepath.Join(srcDir, "b", "file.txt")
+	createDummyFile(t, src1)
+	createDummyFile(t, src2)
+
+	movedFiles, err := trash.Put([]string{src1, src2}, false)
+	assert.NoError(t, err)
+	assert.Len(t, movedFiles, 2)
+	assert.Equal(t, filepath.Join(trash.FilesDir(), "file.txt"), movedFiles[0].To)
+	assert.Equal(t, filepath.Join(trash.FilesDir(), "file.2.txt"), movedFiles[1].To)
+
+	assert.NoFileExists(t, src1)
+	assert.FileExists(t, filepath.Join(trash.InfoDir(), "file.txt.trashinfo"))
+	assert.FileExists(t, filepath.Join(trash.InfoDir(), "file.2.txt.trashinfo"))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	froms := map[string]string{}
+	for _, e := range entries {
+		froms[e.To] = e.From
+	}
+	assert.Equal(t, src1, froms[movedFiles[0].To])
+	assert.Equal(t, src2, froms[movedFiles[1].To])
+}
+
+// 復元したエントリの trashinfo は消え、他のツールにも見えなくなる
+func TestFreedesktopTrash_RestoreRemovesInfo(t *testing.T) {
+	srcDir := t.TempDir()
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+	restored := filepath.Join(srcDir, "restored.txt")
+	kept := filepath.Join(srcDir, "kept.txt")
+	createDummyFile(t, restored)
+	createDummyFile(t, kept)
+	_, err := trash.Put([]string{restored, kept}, false)
+	assert.NoError(t, err)
+
+	entries, err := trash.Query(lib.HistoryQuery{From: restored})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	_, err = lib.RestoreEntries(trash, entries, lib.RestoreOptions{})
+	assert.NoError(t, err)
+
+	assert.FileExists(t, restored)
+	assert.NoFileExists(t, filepath.Join(trash.InfoDir(), "restored.txt"+lib.TrashInfoExt))
+	assert.FileExists(t, filepath.Join(trash.InfoDir(), "kept.txt"+lib.TrashInfoExt))
+	assert.FileExists(t, filepath.Join(trash.Dir, lib.RestoreLogFileName))
+}
+
+// 他のツールで復元されたファイルの trashinfo は Entries では消さず、古くなってから Purge で掃除される
+func TestFreedesktopTrash_RemoveOrphanInfo(t *testing.T) {
+	srcDir := t.TempDir()
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+
+	src := filepath.Join(srcDir, "file.txt")
+	createDummyFile(t, src)
+
+	movedFiles, err := trash.Put([]string{src}, false)
+	assert.NoError(t, err)
+
+	// 復元されたことにする
+	assert.NoError(t, os.Rename(movedFiles[0].To, src))
+	infoPath := filepath.Join(trash.InfoDir(), "file.txt.trashinfo")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.FileExists(t, infoPath)
+
+	// 新しいものは移動中かもしれないので残す
+	purged, err := trash.Purge(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, purged)
+	assert.FileExists(t, infoPath)
+
+	old := time.Now().Add(-lib.OrphanInfoGracePeriod - time.Minute)
+	assert.NoError(t, os.Chtimes(infoPath, old, old))
+	_, err = trash.Purge(nil)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, infoPath)
+}
+
+// 他の書き手が trashinfo を作ってからファイルを移すまでの間に読んでも、trashinfo は消さない
+func TestFreedesktopTrash_EntriesDuringPut(t *testing.T) {
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+	assert.NoError(t, os.MkdirAll(trash.InfoDir(), 0700))
+	assert.NoError(t, os.MkdirAll(trash.FilesDir(), 0700))
+	infoPath := filepath.Join(trash.InfoDir(), "moving.txt.trashinfo")
+	info := lib.NewTrashInfo("/home/user/moving.txt", time.Now())
+	assert.NoError(t, os.WriteFile(infoPath, []byte(info.String()), 0600))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.FileExists(t, infoPath)
+
+	// ファイルが移ってくれば見える
+	createDummyFile(t, filepath.Join(trash.FilesDir(), "moving.txt"))
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "/home/user/moving.txt", entries[0].From)
+}
+
+// 一度に入れたファイルは同じ削除日時になり、undo で一つのバッチになる
+func TestFreedesktopTrash_PutSharesDeletionDate(t *testing.T) {
+	srcDir := t.TempDir()
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+
+	paths := make([]string, 20)
+	for i := range paths {
+		paths[i] = filepath.Join(srcDir, strconv.Itoa(i)+".txt")
+		createDummyFile(t, paths[i])
+	}
+
+	movedFiles, err := trash.Put(paths, false)
+	assert.NoError(t, err)
+	for _, f := range movedFiles {
+		assert.Equal(t, movedFiles[0].MovedAt, f.MovedAt)
+	}
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	batches := lib.GroupByBatch(entries)
+	assert.Len(t, batches, 1)
+	assert.Len(t, batches[0].Entries, len(paths))
+}
+
+// dryrun ではファイルも trashinfo も作成されない
+func TestFreedesktopTrash_DryRun(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file.txt")
+	createDummyFile(t, src)
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+
+	movedFiles, err := trash.Put([]string{src}, true)
+	assert.NoError(t, err)
+	assert.Len(t, movedFiles, 1)
+	assert.FileExists(t, src)
+	assert.NoDirExists(t, trash.Dir)
+}
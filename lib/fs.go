@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// FileSystem is the file operations used to move files into and out of the trash,
+// so that moves can be tested without touching disk.
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	MkdirAll(path string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Open(name string) (fs.File, error)
+	Readlink(name string) (string, error)
+}
+
+var _ FileSystem = OSFileSystem{}
+
+// OSFileSystem is the file system of the OS.
+type OSFileSystem struct{}
+
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSFileSystem) Lstat(name string) (fs.FileInfo, error)       { return os.Lstat(name) }
+func (OSFileSystem) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFileSystem) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (OSFileSystem) Remove(name string) error                     { return os.Remove(name) }
+
+// RemoveAll makes read-only directories writable if needed.
+func (OSFileSystem) RemoveAll(path string) error { return removeAll(path) }
+
+func (OSFileSystem) Open(name string) (fs.File, error)    { return os.Open(name) }
+func (OSFileSystem) Readlink(name string) (string, error) { return os.Readlink(name) }
+
+// fsOrOS returns fsys, or the OS file system if fsys is nil.
+func fsOrOS(fsys FileSystem) FileSystem {
+	if fsys == nil {
+		return OSFileSystem{}
+	}
+	return fsys
+}
+
+// isOS tells whether fsys is the OS file system, which the operations beyond FileSystem,
+// such as copying across filesystems, need.
+func isOS(fsys FileSystem) bool {
+	_, ok := fsOrOS(fsys).(OSFileSystem)
+	return ok
+}
+
+func readFile(fsys FileSystem, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,299 @@
+package lib_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: メモリ上のファイルシステムに移動するゴミ箱。ロックとジャーナルだけディスクに置く
+func newMemTrash(t *testing.T) (*lib.HistoryTrash, *lib.MemFileSystem, lib.HistoryStore) {
+	t.Helper()
+	fsys := lib.NewMemFileSystem()
+	store := lib.NewMemoryHistoryStore()
+	trash := lib.NewHistoryTrash(t.TempDir())
+	trash.FS = fsys
+	trash.OpenStore = func(dir string) (lib.HistoryStore, error) {
+		return store, nil
+	}
+	return trash, fsys, store
+}
+
+// helper: 元の場所となるディレクトリ。ファイルはメモリ上にだけ作る
+func memSrcDir(t *testing.T, fsys *lib.MemFileSystem) string {
+	t.Helper()
+	dir := t.TempDir()
+	assert.NoError(t, fsys.MkdirAll(dir, 0755))
+	t.Cleanup(func() {
+		// ディスクには何も書かれていない
+		children, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Empty(t, children)
+	})
+	return dir
+}
+
+func writeMemFile(t *testing.T, fsys *lib.MemFileSystem, path, content string) {
+	t.Helper()
+	assert.NoError(t, fsys.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, fsys.WriteFile(path, []byte(content), 0644))
+}
+
+func TestMemFileSystem(t *testing.T) {
+	fsys := lib.NewMemFileSystem()
+	writeMemFile(t, fsys, "/a/b/c.txt", "hello")
+
+	fi, err := fsys.Stat("/a/b")
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+
+	// 中身のあるディレクトリは Remove できない
+	assert.ErrorIs(t, fsys.Remove("/a"), syscall.ENOTEMPTY)
+
+	// ディレクトリごと移動する
+	assert.NoError(t, fsys.Rename("/a", "/x"))
+	_, err = fsys.Stat("/a/b/c.txt")
+	assert.True(t, os.IsNotExist(err))
+	f, err := fsys.Open("/x/b/c.txt")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.NoError(t, f.Close())
+
+	// 親が無いところへは移動できない
+	assert.ErrorIs(t, fsys.Rename("/x", "/missing/x"), syscall.ENOENT)
+	// 自分の下へは移動できない
+	assert.ErrorIs(t, fsys.Rename("/x", "/x/b/x"), syscall.EINVAL)
+	// ファイルの下にディレクトリは作れない
+	assert.ErrorIs(t, fsys.MkdirAll("/x/b/c.txt/d", 0755), syscall.ENOTDIR)
+
+	assert.NoError(t, fsys.RemoveAll("/x"))
+	_, err = fsys.Lstat("/x/b")
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, fsys.RemoveAll("/x"))
+
+	// 注入したエラーは消すまで返り続ける
+	writeMemFile(t, fsys, "/y.txt", "y")
+	fsys.Fail("rename", "/y.txt", syscall.EXDEV)
+	assert.ErrorIs(t, fsys.Rename("/y.txt", "/z.txt"), syscall.EXDEV)
+	fsys.Fail("rename", "/y.txt", nil)
+	assert.NoError(t, fsys.Rename("/y.txt", "/z.txt"))
+}
+
+func TestHistoryTrash_PutWithMemFS(t *testing.T) {
+	trash, fsys, store := newMemTrash(t)
+	srcDir := memSrcDir(t, fsys)
+	file := filepath.Join(srcDir, "a.txt")
+	dir := filepath.Join(srcDir, "dir")
+	writeMemFile(t, fsys, file, "hello")
+	writeMemFile(t, fsys, filepath.Join(dir, "child.txt"), "child")
+
+	moved, err := trash.Put([]string{file, dir}, false)
+	assert.NoError(t, err)
+	assert.Len(t, moved, 2)
+
+	for _, f := range moved {
+		_, err := fsys.Lstat(f.From)
+		assert.True(t, os.IsNotExist(err))
+		_, err = fsys.Lstat(f.To)
+		assert.NoError(t, err)
+		assert.Equal(t, trash.Dir, filepath.Dir(f.To))
+	}
+	data, err := fsys.ReadFile(filepath.Join(trash.Dir, "dir", "child.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "child", string(data))
+
+	entries, err := store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, int64(5), moved[0].Metadata.Size)
+	assert.Equal(t, lib.FileTypeFile, moved[0].Metadata.Type)
+
+	// 存在しないファイルは移動しない
+	_, err = trash.Put([]string{filepath.Join(srcDir, "missing.txt")}, false)
+	assert.ErrorIs(t, err, lib.ErrFileNotFound)
+}
+
+// 同じ名前は一度に入れると連番、既にゴミ箱にあるとタイムスタンプが付く
+func TestHistoryTrash_PutDuplicatesWithMemFS(t *testing.T) {
+	trash, fsys, _ := newMemTrash(t)
+	srcDir := memSrcDir(t, fsys)
+	paths := []string{
+		filepath.Join(srcDir, "x", "a.txt"),
+		filepath.Join(srcDir, "y", "a.txt"),
+	}
+	for _, p := range paths {
+		writeMemFile(t, fsys, p, p)
+	}
+
+	moved, err := trash.Put(paths, false)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.txt", "a(1).txt"}, []string{filepath.Base(moved[0].To), filepath.Base(moved[1].To)})
+
+	writeMemFile(t, fsys, paths[0], "again")
+	moved, err = trash.Put(paths[:1], false)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^a\.\d{8}T\d{6}.*\.txt$`, filepath.Base(moved[0].To))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestRestoreEntriesWithMemFS(t *testing.T) {
+	trash, fsys, _ := newMemTrash(t)
+	srcDir := memSrcDir(t, fsys)
+	file := filepath.Join(srcDir, "a.txt")
+	writeMemFile(t, fsys, file, "original")
+
+	_, err := trash.Put([]string{file}, false)
+	assert.NoError(t, err)
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+
+	// 元の場所に別のファイルがあれば名前を変えて戻す
+	writeMemFile(t, fsys, file, "new")
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{Conflict: lib.ConflictRename, FS: fsys})
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	assert.True(t, restored[0].Renamed)
+
+	data, err := fsys.ReadFile(restored[0].To)
+	assert.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+	data, err = fsys.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// 移動に失敗したら、移動済みのファイルも元に戻して履歴にも残さない
+func TestHistoryTrash_PutFailureWithMemFS(t *testing.T) {
+	for name, errno := range map[string]syscall.Errno{
+		"EXDEV":  syscall.EXDEV,
+		"EACCES": syscall.EACCES,
+		"ENOSPC": syscall.ENOSPC,
+	} {
+		t.Run(name, func(t *testing.T) {
+			trash, fsys, store := newMemTrash(t)
+			srcDir := memSrcDir(t, fsys)
+			ok := filepath.Join(srcDir, "ok.txt")
+			failing := filepath.Join(srcDir, "failing.txt")
+			writeMemFile(t, fsys, ok, "ok")
+			writeMemFile(t, fsys, failing, "failing")
+			fsys.Fail("rename", failing, errno)
+
+			moved, err := trash.Put([]string{ok, failing}, false)
+			assert.ErrorIs(t, err, errno)
+			assert.Empty(t, moved)
+
+			for _, p := range []string{ok, failing} {
+				_, err := fsys.Lstat(p)
+				assert.NoError(t, err, p)
+			}
+			entries, err := store.Load()
+			assert.NoError(t, err)
+			assert.Empty(t, entries)
+			assert.NoFileExists(t, filepath.Join(trash.Dir, lib.JournalFileName))
+		})
+	}
+}
+
+// 戻すのに失敗したエントリはゴミ箱に残る
+func TestRestoreEntriesFailureWithMemFS(t *testing.T) {
+	trash, fsys, _ := newMemTrash(t)
+	srcDir := memSrcDir(t, fsys)
+	file := filepath.Join(srcDir, "a.txt")
+	writeMemFile(t, fsys, file, "a")
+
+	moved, err := trash.Put([]string{file}, false)
+	assert.NoError(t, err)
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+
+	fsys.Fail("rename", moved[0].To, syscall.EACCES)
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{FS: fsys})
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.Empty(t, restored)
+
+	// どのファイルが失敗したか取り出せる
+	failed := lib.FileErrors(err)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, moved[0].To, failed[0].From)
+	assert.Equal(t, file, failed[0].To)
+	assert.ErrorIs(t, failed[0], syscall.EACCES)
+
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// freedesktop でもファイルはメモリ上で移動し、info だけディスクに置く
+func TestFreedesktopTrash_PutWithMemFS(t *testing.T) {
+	fsys := lib.NewMemFileSystem()
+	trash := lib.NewFreedesktopTrash(filepath.Join(t.TempDir(), "Trash"))
+	trash.FS = fsys
+	srcDir := memSrcDir(t, fsys)
+	file := filepath.Join(srcDir, "a.txt")
+	writeMemFile(t, fsys, file, "a")
+
+	moved, err := trash.Put([]string{file}, false)
+	assert.NoError(t, err)
+	assert.Len(t, moved, 1)
+	assert.Equal(t, filepath.Join(trash.FilesDir(), "a.txt"), moved[0].To)
+	data, err := fsys.ReadFile(moved[0].To)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+	assert.NoDirExists(t, trash.FilesDir())
+	assert.FileExists(t, filepath.Join(trash.InfoDir(), "a.txt"+lib.TrashInfoExt))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, file, entries[0].From)
+
+	purged, err := trash.Purge(entries)
+	assert.NoError(t, err)
+	assert.Len(t, purged, 1)
+	_, err = fsys.Lstat(moved[0].To)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoFileExists(t, filepath.Join(trash.InfoDir(), "a.txt"+lib.TrashInfoExt))
+}
+
+// 上書きで退けたファイルは、その場所への復元に失敗したら元に戻す
+func TestRestoreEntriesOverwriteFailureWithMemFS(t *testing.T) {
+	trash, fsys, _ := newMemTrash(t)
+	srcDir := memSrcDir(t, fsys)
+	file := filepath.Join(srcDir, "a.txt")
+	writeMemFile(t, fsys, file, "trashed")
+
+	moved, err := trash.Put([]string{file}, false)
+	assert.NoError(t, err)
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	writeMemFile(t, fsys, file, "current")
+
+	fsys.Fail("rename", moved[0].To, syscall.EACCES)
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{Conflict: lib.ConflictOverwrite, FS: fsys})
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.Empty(t, restored)
+
+	data, err := fsys.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "current", string(data))
+
+	// ゴミ箱には復元できなかったエントリだけが残る
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, moved[0].To, entries[0].To)
+}
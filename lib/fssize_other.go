@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package lib
+
+import (
+	"github.com/cockroachdb/errors"
+)
+
+// filesystemSize is not supported, so percent quotas are ignored.
+func filesystemSize(path string) (int64, error) {
+	return 0, errors.New("filesystem size is not supported on this platform")
+}
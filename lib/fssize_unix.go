@@ -0,0 +1,16 @@
+//go:build linux || darwin
+
+package lib
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// filesystemSize returns the total size of the filesystem which path is on.
+func filesystemSize(path string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), nil
+}
@@ -2,7 +2,12 @@ package lib
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"slices"
@@ -12,8 +17,11 @@ import (
 )
 
 const (
-	HistoryFileName = "go-to-trash-history.json"
-	RemovedAtFormat = time.RFC3339
+	HistoryFileName  = "go-to-trash-history.json"
+	HistoryBackupExt = ".bak"
+	RemovedAtFormat  = time.RFC3339
+
+	HistoryEntryIDLength = 8
 )
 
 var (
@@ -53,6 +61,16 @@ type HistoryEntry struct {
 	From    string    `json:"from"`
 	To      string    `json:"to"`
 	Removed RemovedAt `json:"removed_at"`
+	// Pinned entries are never evicted by the quota.
+	Pinned bool `json:"pinned,omitempty"`
+	// Metadata is nil for the entries recorded by older versions.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// ID is a short stable identifier of the entry, derived from its path in trash and removal time.
+func (e HistoryEntry) ID() string {
+	sum := sha1.Sum([]byte(e.To + "\x00" + e.Removed.String()))
+	return hex.EncodeToString(sum[:])[:HistoryEntryIDLength]
 }
 
 func NewHistoryEntry(from, to string, removed RemovedAt) HistoryEntry {
@@ -67,9 +85,10 @@ func NewHistoryEntriesFromMovedFiles(files []MovedFile) []HistoryEntry {
 	entries := make([]HistoryEntry, len(files))
 	for i, file := range files {
 		entries[i] = HistoryEntry{
-			From:    file.From,
-			To:      file.To,
-			Removed: RemovedAt(file.MovedAt),
+			From:     file.From,
+			To:       file.To,
+			Removed:  RemovedAt(file.MovedAt),
+			Metadata: file.Metadata,
 		}
 	}
 	return entries
@@ -89,15 +108,30 @@ func (entries HistoryEntries) Sorted() HistoryEntries {
 	})
 }
 
+// Recent returns the entries sorted from the most recently removed.
+func (entries HistoryEntries) Recent() HistoryEntries {
+	sorted := entries.Sorted()
+	slices.Reverse(sorted)
+	return sorted
+}
+
 type History struct {
 	Path    string
 	Entries []HistoryEntry
+	// Version is the format version of the file, which is rewritten in the current format on the next write if older.
+	Version int
+	// FS is where SyncHistory looks for the files in trash, the OS file system if nil.
+	FS FileSystem
+	// Unparsed is the lines which could not be parsed, such as a line torn by a crash or edited by hand.
+	// They are written back as is, so that rewriting the history never drops them.
+	Unparsed [][]byte
 }
 
 func NewHistory(path string, entries []HistoryEntry) *History {
 	return &History{
 		Path:    path,
 		Entries: entries,
+		Version: HistoryFormatVersion,
 	}
 }
 
@@ -105,19 +139,41 @@ func LoadHistory(trashDir string) (*History, error) {
 	// history file path
 	path := filepath.Join(trashDir, HistoryFileName)
 
-	f, err := os.Open(path)
+	f, err := openHistoryFile(path)
 	if err != nil {
 		// history file not found
 		return NewHistory(path, nil), nil
 	}
 	defer f.Close()
 
-	var entries []HistoryEntry
+	version := HistoryFormatLegacy
+	var (
+		entries  []HistoryEntry
+		unparsed [][]byte
+	)
 	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		var entry HistoryEntry
-		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-			// skip invalid lines
+	// a long command line in the metadata can exceed the default limit
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+
+		if n == 1 {
+			if header, ok := parseHistoryHeader(line); ok {
+				if err := checkHistoryVersion(path, header.Version); err != nil {
+					return nil, err
+				}
+				version = header.Version
+				continue
+			}
+		}
+
+		entry, err := parseHistoryLine(line, version)
+		if err != nil {
+			// skip invalid lines, but keep them for the next rewrite
+			log.Printf("skip line %d of %v: %v", n, path, err)
+			if len(bytes.TrimSpace(line)) > 0 {
+				unparsed = append(unparsed, slices.Clone(line))
+			}
 			continue
 		}
 		entries = append(entries, entry)
@@ -128,13 +184,47 @@ func LoadHistory(trashDir string) (*History, error) {
 		return nil, errors.Wrap(err, "failed to scan history file")
 	}
 
-	return NewHistory(path, entries), nil
+	history := NewHistory(path, entries)
+	history.Version = version
+	history.Unparsed = unparsed
+	return history, nil
+}
+
+func parseHistoryLine(line []byte, version int) (HistoryEntry, error) {
+	migrated, err := migrateHistoryLine(line, version)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	var entry HistoryEntry
+	if err := json.Unmarshal(migrated, &entry); err != nil {
+		return HistoryEntry{}, err
+	}
+	if entry.From == "" || entry.To == "" {
+		return HistoryEntry{}, errors.Wrap(ErrHistoryInvalid, "missing from or to")
+	}
+	return entry, nil
+}
+
+// openHistoryFile opens the history, or its backup if a crash left only the backup.
+func openHistoryFile(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err == nil || !os.IsNotExist(err) {
+		return f, err
+	}
+
+	f, bakErr := os.Open(backupPath(path))
+	if bakErr != nil {
+		return nil, err
+	}
+	log.Printf("%v is not found, recover from %v", path, f.Name())
+	return f, nil
 }
 
 func (h *History) UpdateHistory(entries []HistoryEntry) error {
 	// save
-	if err := h.saveHistory(entries); err != nil {
-		return errors.Wrap(err, "save history")
+	if err := h.AppendHistory(entries); err != nil {
+		return errors.Wrap(err, "append history")
 	}
 	if err := h.SyncHistory(); err != nil {
 		return errors.Wrap(err, "sync history")
@@ -143,6 +233,16 @@ func (h *History) UpdateHistory(entries []HistoryEntry) error {
 	return nil
 }
 
+// AppendHistory saves entries without checking the existing ones.
+func (h *History) AppendHistory(entries []HistoryEntry) error {
+	if err := h.saveHistory(entries); err != nil {
+		return errors.Wrap(err, "save history")
+	}
+	h.Entries = append(h.Entries, entries...)
+
+	return nil
+}
+
 func (h *History) saveHistory(entries []HistoryEntry) error {
 	if len(entries) == 0 {
 		return nil
@@ -152,12 +252,17 @@ func (h *History) saveHistory(entries []HistoryEntry) error {
 	_, err := os.Stat(h.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// if the file does not exist, create and write all history
-			return writeEntriesToHistory(h.Path, entries)
+			// if the file does not exist, create and write all history (which may be recovered from the backup)
+			return h.rewrite(append(slices.Clone(h.Entries), entries...))
 		}
 		return errors.Wrap(err, "failed to check history file existence")
 	}
 
+	// an older format is migrated rather than mixed with new lines
+	if h.Version != HistoryFormatVersion {
+		return h.rewrite(append(slices.Clone(h.Entries), entries...))
+	}
+
 	// if the file exists, append only new entries
 	return appendEntriesToHistory(h.Path, entries)
 }
@@ -168,7 +273,7 @@ func (h *History) SyncHistory() error {
 
 	// scan through the slice and remove unnecessary elements
 	for _, entry := range uniqHist {
-		_, err := os.Stat(entry.To)
+		_, err := fsOrOS(h.FS).Stat(entry.To)
 		if err != nil {
 			if os.IsNotExist(err) {
 				// if the file does not exist, skip it (remove from history)
@@ -187,19 +292,102 @@ func (h *History) SyncHistory() error {
 
 	// update history files
 	h.Entries = validFiles
-	return writeEntriesToHistory(h.Path, h.Entries)
+	return h.rewrite(h.Entries)
 }
 
-func writeEntriesToHistory(path string, entries []HistoryEntry) error {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+// RemoveEntries drops entries from the history, matched by their path in trash.
+func (h *History) RemoveEntries(entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	removed := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		removed[e.To] = struct{}{}
+	}
+
+	kept := make([]HistoryEntry, 0, len(h.Entries))
+	for _, e := range h.Entries {
+		if _, ok := removed[e.To]; !ok {
+			kept = append(kept, e)
+		}
+	}
+
+	h.Entries = kept
+	return h.rewrite(h.Entries)
+}
+
+// Rewrite writes all the entries in the current format.
+func (h *History) Rewrite() error {
+	return h.rewrite(h.Entries)
+}
+
+func (h *History) rewrite(entries []HistoryEntry) error {
+	if err := writeEntriesToHistory(h.Path, entries, h.Unparsed); err != nil {
+		return err
+	}
+	h.Version = HistoryFormatVersion
+	return nil
+}
+
+// writeEntriesToHistory replaces the history atomically: entries are written to a temp file in the same dir,
+// flushed to disk and renamed over the history. The previous generation is kept as `.bak`.
+// The unparsed lines are written unchanged before the entries.
+func writeEntriesToHistory(path string, entries []HistoryEntry, unparsed [][]byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
 	if err != nil {
-		return errors.Wrap(err, "failed to create history file")
+		return errors.Wrap(err, "failed to create temp history file")
 	}
-	defer f.Close()
+	tmpPath := f.Name()
+	// no-op once renamed
+	defer os.Remove(tmpPath)
+
+	if err := writeJSONLines(f, []HistoryHeader{NewHistoryHeader()}); err != nil {
+		f.Close()
+		return err
+	}
+	for _, line := range unparsed {
+		if _, err := f.Write(append(slices.Clone(line), '\n')); err != nil {
+			f.Close()
+			return errors.Wrap(err, "failed to write unparsed line to temp history file")
+		}
+	}
+	if err := writeEntries(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to fsync temp history file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temp history file")
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return errors.Wrap(err, "failed to chmod temp history file")
+	}
+
+	if err := backupHistory(path); err != nil {
+		return errors.Wrap(err, "failed to back up history file")
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "failed to replace history file")
+	}
+
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+func writeEntries(w io.Writer, entries []HistoryEntry) error {
+	return writeJSONLines(w, entries)
+}
 
-	writer := bufio.NewWriter(f)
-	for _, entry := range entries {
-		data, err := json.Marshal(entry)
+// writeJSONLines writes each value as a line of JSON.
+func writeJSONLines[T any](w io.Writer, values []T) error {
+	writer := bufio.NewWriter(w)
+	for _, v := range values {
+		data, err := json.Marshal(v)
 		if err != nil {
 			return errors.Wrap(err, "failed to marshal file entry")
 		}
@@ -211,25 +399,91 @@ func writeEntriesToHistory(path string, entries []HistoryEntry) error {
 	return writer.Flush()
 }
 
+func backupPath(path string) string {
+	return path + HistoryBackupExt
+}
+
+// backupHistory keeps the current history as `.bak` before it is replaced.
+func backupHistory(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	bak := backupPath(path)
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove old backup")
+	}
+
+	// a hard link is enough since the history is replaced by rename, not rewritten in place
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open history")
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(bak, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create backup")
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "copy history")
+	}
+	return dst.Close()
+}
+
+// syncDir flushes the rename to disk. It's best effort since some platforms can't fsync a dir.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
+
 func appendEntriesToHistory(path string, entries []HistoryEntry) error {
 	uniqFiles := UniqByKey(entries, func(entry HistoryEntry) string { return entry.To })
 
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0644)
 	if err != nil {
 		return errors.Wrap(err, "failed to open history file for appending")
 	}
 	defer f.Close()
 
-	writer := bufio.NewWriter(f)
-	for _, entry := range uniqFiles {
-		data, err := json.Marshal(entry)
-		if err != nil {
-			return errors.Wrap(err, "failed to marshal file entry")
-		}
-		if _, err := writer.Write(append(data, '\n')); err != nil {
-			return errors.Wrap(err, "failed to write to history file")
-		}
+	// a line torn by a crash must not swallow the next entry
+	if err := terminateLastLine(f); err != nil {
+		return err
 	}
 
-	return writer.Flush()
+	if err := writeEntries(f, uniqFiles); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func terminateLastLine(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat history file")
+	}
+	if fi.Size() == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, fi.Size()-1); err != nil {
+		return errors.Wrap(err, "failed to read history file")
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	_, err = f.Write([]byte{'\n'})
+	return errors.Wrap(err, "failed to write to history file")
 }
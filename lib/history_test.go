@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,6 +32,10 @@ func readHistoryFile(t *testing.T, path string) []lib.ToBeMovedFile {
 	var entries []lib.ToBeMovedFile
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
+		// ヘッダ行はエントリではない
+		if strings.Contains(scanner.Text(), lib.HistoryFormatName) {
+			continue
+		}
 		var entry lib.ToBeMovedFile
 		err := json.Unmarshal(scanner.Bytes(), &entry)
 		if err == nil {
@@ -213,3 +218,136 @@ func TestUpdateHistory_NoNewFiles(t *testing.T) {
 	assert.Len(t, entries, 1)
 	assert.Equal(t, entry.From, entries[0].From)
 }
+
+// Test case 5: 履歴の書き換えは一時ファイル経由で行われ、前の世代が .bak に残る
+func TestSyncHistory_AtomicRewriteWithBackup(t *testing.T) {
+	trashDir := t.TempDir()
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+
+	validEntry := lib.HistoryEntry{
+		From:    "/source/path/valid.txt",
+		To:      filepath.Join(trashDir, "trash_valid.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	invalidEntry := lib.HistoryEntry{
+		From:    "/source/path/invalid.txt",
+		To:      filepath.Join(trashDir, "trash_invalid.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, validEntry.To)
+	createDummyFile(t, invalidEntry.To)
+
+	hist := lib.NewHistory(historyPath, nil)
+	assert.NoError(t, hist.UpdateHistory([]lib.HistoryEntry{validEntry, invalidEntry}))
+
+	// invalidEntry のファイルを消して書き換えを起こす
+	assert.NoError(t, os.Remove(invalidEntry.To))
+	assert.NoError(t, hist.SyncHistory())
+
+	entries := readHistoryFile(t, historyPath)
+	assert.Len(t, entries, 1)
+	backup := readHistoryFile(t, historyPath+lib.HistoryBackupExt)
+	assert.Len(t, backup, 2)
+
+	// 一時ファイルは残らない
+	matches, err := filepath.Glob(filepath.Join(trashDir, ".*.tmp-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+// Test case 6: 履歴ファイルが失われていれば .bak から読み込み、次の書き込みで復元される
+func TestLoadHistory_RecoverFromBackup(t *testing.T) {
+	trashDir := t.TempDir()
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+
+	entry := lib.HistoryEntry{
+		From:    "/source/path/entry.txt",
+		To:      filepath.Join(trashDir, "trash_entry.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, entry.To)
+	data, err := json.Marshal(entry)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(historyPath+lib.HistoryBackupExt, append(data, '\n'), 0644))
+
+	hist, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, hist.Entries, 1)
+
+	newEntry := lib.HistoryEntry{
+		From:    "/source/path/new.txt",
+		To:      filepath.Join(trashDir, "trash_new.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, newEntry.To)
+	assert.NoError(t, hist.UpdateHistory([]lib.HistoryEntry{newEntry}))
+
+	entries := readHistoryFile(t, historyPath)
+	assert.Len(t, entries, 2)
+}
+
+// Test case 7: 途中で途切れた行があっても、追記したエントリは失われない
+func TestUpdateHistory_AppendAfterTornLine(t *testing.T) {
+	trashDir := t.TempDir()
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+	header := `{"format":"go-to-trash-history","version":2}` + "\n"
+	assert.NoError(t, os.WriteFile(historyPath, []byte(header+`{"from":"/source/path/torn.txt","to":`), 0644))
+	before, err := os.Stat(historyPath)
+	assert.NoError(t, err)
+
+	entry := lib.HistoryEntry{
+		From:    "/source/path/entry.txt",
+		To:      filepath.Join(trashDir, "trash_entry.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, entry.To)
+
+	hist, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.NoError(t, hist.AppendHistory([]lib.HistoryEntry{entry}))
+
+	entries := readHistoryFile(t, historyPath)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entry.From, entries[0].From)
+
+	// 書き換えではなく追記されている
+	after, err := os.Stat(historyPath)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(before, after))
+	assert.NoFileExists(t, historyPath+lib.HistoryBackupExt)
+	content, err := os.ReadFile(historyPath)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), header))
+}
+
+// Test case 8: 読めない行は書き換えても消えずにそのまま残る
+func TestRemoveEntries_KeepsUnparsedLines(t *testing.T) {
+	trashDir := t.TempDir()
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+	kept := lib.NewHistoryEntry("/source/path/kept.txt", filepath.Join(trashDir, "kept.txt"), lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)))
+	removed := lib.NewHistoryEntry("/source/path/removed.txt", filepath.Join(trashDir, "removed.txt"), lib.RemovedAt(time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)))
+	createDummyFile(t, kept.To)
+
+	hist := lib.NewHistory(historyPath, nil)
+	assert.NoError(t, hist.AppendHistory([]lib.HistoryEntry{kept, removed}))
+	unparsed := `{"from":"/source/path/edited.txt","to":`
+	f, err := os.OpenFile(historyPath, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(unparsed + "\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	hist, err = lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, hist.Entries, 2)
+	assert.NoError(t, hist.RemoveEntries([]lib.HistoryEntry{removed}))
+	// 同期でも消えない
+	assert.NoError(t, hist.SyncHistory())
+
+	content, err := os.ReadFile(historyPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), unparsed+"\n")
+	entries := readHistoryFile(t, historyPath)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, kept.From, entries[0].From)
+}
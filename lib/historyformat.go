@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"encoding/json"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// HistoryFormatName identifies the header record at the first line of the history.
+	HistoryFormatName = "go-to-trash-history"
+	// HistoryFormatVersion is the version written by this version of gototrash.
+	//
+	//	1: no header, each line is {from, to, removed_at}
+	//	2: header record, entries may have pinned and metadata
+	HistoryFormatVersion = 2
+	// HistoryFormatLegacy is the version of histories without the header.
+	HistoryFormatLegacy = 1
+)
+
+var (
+	ErrHistoryTooNew = errors.New("history format is newer than supported")
+)
+
+// HistoryHeader is the first line of the history, which tells how to read the rest.
+type HistoryHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+func NewHistoryHeader() HistoryHeader {
+	return HistoryHeader{
+		Format:  HistoryFormatName,
+		Version: HistoryFormatVersion,
+	}
+}
+
+// Migration is the format version of a history before and after migration.
+type Migration struct {
+	Path string
+	From int
+	To   int
+	// Imported is the number of entries imported into another store, if the history has been imported.
+	Imported int
+	// Compacted is true if the store has been compacted rather than migrated.
+	Compacted bool
+}
+
+// parseHistoryHeader returns the header if line is one.
+func parseHistoryHeader(line []byte) (HistoryHeader, bool) {
+	var header HistoryHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Format != HistoryFormatName {
+		return HistoryHeader{}, false
+	}
+	return header, true
+}
+
+func checkHistoryVersion(path string, version int) error {
+	if version > HistoryFormatVersion {
+		return errors.Wrapf(ErrHistoryTooNew,
+			"%v is version %d but this gototrash supports up to %d, please upgrade gototrash", path, version, HistoryFormatVersion)
+	}
+	if version < HistoryFormatLegacy {
+		return errors.Wrapf(ErrHistoryInvalid, "%v has an invalid version %d", path, version)
+	}
+	return nil
+}
+
+// historyMigrations[v] converts a line of version v into version v+1.
+var historyMigrations = map[int]func(line []byte) ([]byte, error){
+	1: migrateHistoryV1,
+}
+
+// migrateHistoryLine converts a line of version into the current version.
+func migrateHistoryLine(line []byte, version int) ([]byte, error) {
+	for v := version; v < HistoryFormatVersion; v++ {
+		migrate, ok := historyMigrations[v]
+		if !ok {
+			return nil, errors.Newf("no migration from version %d", v)
+		}
+
+		var err error
+		line, err = migrate(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migrate from version %d", v)
+		}
+	}
+	return line, nil
+}
+
+// migrateHistoryV1 only checks the line since version 2 only adds optional fields.
+func migrateHistoryV1(line []byte) ([]byte, error) {
+	var v1 struct {
+		From    *string `json:"from"`
+		To      *string `json:"to"`
+		Removed *string `json:"removed_at"`
+	}
+	if err := json.Unmarshal(line, &v1); err != nil {
+		return nil, err
+	}
+	if v1.From == nil || v1.To == nil || v1.Removed == nil {
+		return nil, errors.Wrap(ErrHistoryInvalid, "missing from, to or removed_at")
+	}
+	return line, nil
+}
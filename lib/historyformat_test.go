@@ -0,0 +1,114 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// 新しく書き出した履歴の先頭行はヘッダ
+func TestHistory_WritesHeader(t *testing.T) {
+	trash := lib.NewHistoryTrash(t.TempDir())
+	putFiles(t, trash, "a.txt")
+
+	data, err := os.ReadFile(filepath.Join(trash.Dir, lib.HistoryFileName))
+	assert.NoError(t, err)
+	first, _, _ := strings.Cut(string(data), "\n")
+	assert.JSONEq(t, `{"format":"go-to-trash-history","version":2}`, first)
+}
+
+// ヘッダのない古い形式は読み込め、次の書き込みで現在の形式に移行される
+func TestHistory_MigrateLegacyOnWrite(t *testing.T) {
+	trashDir := t.TempDir()
+	old := filepath.Join(trashDir, "old.txt")
+	createDummyFile(t, old)
+	legacy := `{"from":"/home/user/old.txt","to":"` + old + `","removed_at":"2023-10-01T00:00:00Z"}` + "\n"
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+	assert.NoError(t, os.WriteFile(historyPath, []byte(legacy), 0644))
+
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryFormatLegacy, history.Version)
+	assert.Len(t, history.Entries, 1)
+
+	putFiles(t, lib.NewHistoryTrash(trashDir), "new.txt")
+
+	history, err = lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryFormatVersion, history.Version)
+	assert.Len(t, history.Entries, 2)
+	assert.Equal(t, "/home/user/old.txt", history.Entries[0].From)
+}
+
+// 対応していない新しい形式は読み込みを拒否し、書き換えもしない
+func TestHistory_RefuseNewerVersion(t *testing.T) {
+	trashDir := t.TempDir()
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+	newer := `{"format":"go-to-trash-history","version":99}` + "\n" + `{"from":"/a","to":"/b","removed_at":"2023-10-01T00:00:00Z","extra":1}` + "\n"
+	assert.NoError(t, os.WriteFile(historyPath, []byte(newer), 0644))
+
+	_, err := lib.LoadHistory(trashDir)
+	assert.ErrorIs(t, err, lib.ErrHistoryTooNew)
+
+	src := filepath.Join(t.TempDir(), "file.txt")
+	createDummyFile(t, src)
+	_, err = lib.NewHistoryTrash(trashDir).Put([]string{src}, false)
+	assert.ErrorIs(t, err, lib.ErrHistoryTooNew)
+	assert.FileExists(t, src)
+
+	data, err := os.ReadFile(historyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, newer, string(data))
+}
+
+// 必須項目の欠けた行は読み飛ばされる
+func TestLoadHistory_SkipInvalidLines(t *testing.T) {
+	trashDir := t.TempDir()
+	lines := strings.Join([]string{
+		`{"format":"go-to-trash-history","version":2}`,
+		`{"from":"/home/user/a.txt","to":"/trash/a.txt","removed_at":"2023-10-01T00:00:00Z"}`,
+		`{"from":"/home/user/b.txt","removed_at":"2023-10-01T00:00:00Z"}`,
+		`{"from":"/home/user/c.txt","to":"/tr`,
+	}, "\n")
+	assert.NoError(t, os.WriteFile(filepath.Join(trashDir, lib.HistoryFileName), []byte(lines), 0644))
+
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, history.Entries, 1)
+	assert.Equal(t, "/home/user/a.txt", history.Entries[0].From)
+}
+
+func TestHistoryTrash_Migrate(t *testing.T) {
+	trashDir := t.TempDir()
+	old := filepath.Join(trashDir, "old.txt")
+	createDummyFile(t, old)
+	// ゴミ箱から消えたファイルのエントリも移行では消さない
+	legacy := `{"from":"/home/user/old.txt","to":"` + old + `","removed_at":"2023-10-01T00:00:00Z"}` + "\n" +
+		`{"from":"/home/user/gone.txt","to":"` + filepath.Join(trashDir, "gone.txt") + `","removed_at":"2023-10-01T00:00:00Z"}` + "\n"
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+	assert.NoError(t, os.WriteFile(historyPath, []byte(legacy), 0644))
+
+	trash := lib.NewHistoryTrash(trashDir)
+
+	migrations, err := trash.Migrate(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []lib.Migration{{Path: historyPath, From: 1, To: lib.HistoryFormatVersion}}, migrations)
+	data, err := os.ReadFile(historyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, string(data))
+
+	_, err = trash.Migrate(false)
+	assert.NoError(t, err)
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryFormatVersion, history.Version)
+	assert.Len(t, history.Entries, 2)
+
+	migrations, err = trash.Migrate(false)
+	assert.NoError(t, err)
+	assert.Equal(t, lib.HistoryFormatVersion, migrations[0].From)
+}
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+)
+
+const JournalFileName = "go-to-trash-journal.json"
+
+// Journal records the files which are about to be moved into the trash,
+// so that an interrupted batch can be recovered at next startup.
+type Journal struct {
+	Path string
+	// FS is where Recover looks for the moved files, the OS file system if nil. The journal itself is on disk.
+	FS FileSystem
+}
+
+func NewJournal(trashDir string) *Journal {
+	return &Journal{
+		Path: filepath.Join(trashDir, JournalFileName),
+	}
+}
+
+// Begin writes the intent of the batch and flushes it to disk before anything is moved.
+func (j *Journal) Begin(entries []HistoryEntry) error {
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0777); err != nil {
+		return errors.Wrap(err, "mkdirall")
+	}
+
+	f, err := os.OpenFile(j.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create journal")
+	}
+	defer f.Close()
+
+	if err := writeEntries(f, entries); err != nil {
+		return errors.Wrap(err, "failed to write journal")
+	}
+
+	return f.Sync()
+}
+
+// End removes the journal once the batch is either committed or rolled back.
+func (j *Journal) End() error {
+	if err := os.Remove(j.Path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove journal")
+	}
+	return nil
+}
+
+func (j *Journal) load() ([]HistoryEntry, error) {
+	f, err := os.Open(j.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to open journal")
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last line may be torn by a crash
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to scan journal")
+	}
+
+	return entries, nil
+}
+
+// Recover records the files of an interrupted batch which have reached the trash but not the history.
+// Nothing is deleted: if both the source and the destination exist, the destination is kept and recorded too.
+func (j *Journal) Recover(store HistoryStore) error {
+	entries, err := j.load()
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		return nil
+	}
+
+	fsys := fsOrOS(j.FS)
+	lost := make([]HistoryEntry, 0)
+	for _, e := range entries {
+		recorded, err := store.Query(HistoryQuery{To: e.To})
+		if err != nil {
+			return errors.Wrap(err, "failed to query history")
+		}
+		if len(recorded) > 0 {
+			continue
+		}
+		if _, err := fsys.Lstat(e.To); err != nil {
+			// never moved
+			continue
+		}
+		if _, err := fsys.Lstat(e.From); err == nil {
+			log.Printf("both %v and %v exist, the move may have been interrupted", e.From, e.To)
+		}
+		log.Printf("recover interrupted trash: %v → %v", e.From, e.To)
+		lost = append(lost, e)
+	}
+
+	if err := store.Append(lost); err != nil {
+		return errors.Wrap(err, "failed to record recovered entries")
+	}
+
+	return j.End()
+}
@@ -0,0 +1,85 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// 中断されたバッチのうち、ゴミ箱に移動済みで履歴に無いものだけが復旧される
+func TestJournal_Recover(t *testing.T) {
+	trashDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	moved := lib.HistoryEntry{
+		From:    filepath.Join(srcDir, "moved.txt"),
+		To:      filepath.Join(trashDir, "moved.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	notMoved := lib.HistoryEntry{
+		From:    filepath.Join(srcDir, "not_moved.txt"),
+		To:      filepath.Join(trashDir, "not_moved.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, moved.To)
+	createDummyFile(t, notMoved.From)
+
+	journal := lib.NewJournal(trashDir)
+	assert.NoError(t, journal.Begin([]lib.HistoryEntry{moved, notMoved}))
+
+	hist, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.NoError(t, journal.Recover(hist))
+
+	assert.Len(t, hist.Entries, 1)
+	assert.Equal(t, moved.From, hist.Entries[0].From)
+	assert.NoFileExists(t, journal.Path)
+
+	// 履歴ファイルにも書き込まれている
+	entries := readHistoryFile(t, hist.Path)
+	assert.Len(t, entries, 1)
+}
+
+// 起動時 (Entries) にジャーナルが復旧される
+func TestHistoryTrash_RecoverOnLoad(t *testing.T) {
+	trashDir := t.TempDir()
+	entry := lib.HistoryEntry{
+		From:    filepath.Join(t.TempDir(), "file.txt"),
+		To:      filepath.Join(trashDir, "file.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, entry.To)
+	assert.NoError(t, lib.NewJournal(trashDir).Begin([]lib.HistoryEntry{entry}))
+
+	entries, err := lib.NewHistoryTrash(trashDir).Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entry.From, entries[0].From)
+}
+
+// バッチの一部が失敗した場合、移動済みのファイルは元に戻され履歴にも残らない
+func TestHistoryTrash_RollbackOnPartialFailure(t *testing.T) {
+	srcDir := t.TempDir()
+	// ゴミ箱を削除対象のディレクトリの中に置くと、ディレクトリの移動が失敗する
+	trashDir := filepath.Join(srcDir, "trash")
+	assert.NoError(t, os.MkdirAll(trashDir, 0755))
+
+	file := filepath.Join(srcDir, "file.txt")
+	createDummyFile(t, file)
+
+	trash := lib.NewHistoryTrash(trashDir)
+	_, err := trash.Put([]string{file, srcDir}, false)
+	assert.Error(t, err)
+
+	assert.FileExists(t, file)
+	assert.NoFileExists(t, filepath.Join(trashDir, "file.txt"))
+	assert.NoFileExists(t, filepath.Join(trashDir, lib.JournalFileName))
+
+	hist, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Empty(t, hist.Entries)
+}
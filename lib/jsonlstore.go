@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"github.com/cockroachdb/errors"
+)
+
+var _ HistoryStore = (*History)(nil)
+
+// OpenJSONLHistoryStore opens the JSON lines history in trashDir, which is read as a whole and
+// rewritten on removal.
+func OpenJSONLHistoryStore(trashDir string) (*History, error) {
+	history, err := LoadHistory(trashDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load history")
+	}
+	return history, nil
+}
+
+func (h *History) Load() (HistoryEntries, error) {
+	return h.Entries, nil
+}
+
+func (h *History) Append(entries []HistoryEntry) error {
+	replaced := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		replaced[e.To] = struct{}{}
+	}
+	for _, e := range h.Entries {
+		if _, ok := replaced[e.To]; ok {
+			// the entry of a file which has left the trash with the same name
+			if err := h.RemoveEntries(entries); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return h.AppendHistory(entries)
+}
+
+func (h *History) Remove(entries []HistoryEntry) error {
+	return h.RemoveEntries(entries)
+}
+
+func (h *History) Query(q HistoryQuery) (HistoryEntries, error) {
+	matched := make(HistoryEntries, 0)
+	for _, e := range h.Entries {
+		if q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+// Compact rewrites the history in the current format without duplicated entries.
+func (h *History) Compact() error {
+	h.Entries = UniqByKey(h.Entries, func(e HistoryEntry) string { return e.To })
+	return h.rewrite(h.Entries)
+}
+
+func (h *History) Close() error {
+	return nil
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	ListFormatTable  = "table"
+	ListFormatJSON   = "json"
+	ListFormatCSV    = "csv"
+	ListFormatNDJSON = "ndjson"
+
+	ListSortRemoved = "removed"
+	ListSortFrom    = "from"
+	ListSortTo      = "to"
+	ListSortSize    = "size"
+	ListSortID      = "id"
+	ListSortType    = "type"
+
+	FileTypeFile    = "file"
+	FileTypeDir     = "dir"
+	FileTypeSymlink = "symlink"
+	FileTypeOther   = "other"
+)
+
+var (
+	ErrInvalidListFormat = errors.New("invalid list format")
+	ErrInvalidSortKey    = errors.New("invalid sort key")
+	ErrInvalidTime       = errors.New("invalid time")
+)
+
+// ListItem is an entry with what can be seen of it in the trash.
+type ListItem struct {
+	ID      string    `json:"id"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Removed RemovedAt `json:"removed_at"`
+	Size    int64     `json:"size"`
+	Type    string    `json:"type"`
+	Pinned  bool      `json:"pinned"`
+
+	// recorded when the entry was trashed, empty for the entries recorded by older versions
+	Mode     string     `json:"mode,omitempty"`
+	Owner    string     `json:"owner,omitempty"`
+	ModTime  *time.Time `json:"mtime,omitempty"`
+	Hostname string     `json:"hostname,omitempty"`
+	Cwd      string     `json:"cwd,omitempty"`
+	Cmdline  []string   `json:"cmdline,omitempty"`
+	BatchID  string     `json:"batch_id,omitempty"`
+}
+
+// NewListItem reads what the entry has not recorded from fsys, the OS file system if nil.
+func NewListItem(fsys FileSystem, e HistoryEntry) (ListItem, error) {
+	item := ListItem{
+		ID:      e.ID(),
+		From:    e.From,
+		To:      e.To,
+		Removed: e.Removed,
+		Pinned:  e.Pinned,
+	}
+
+	if m := e.Metadata; m != nil {
+		item.Size = m.Size
+		item.Type = m.Type
+		item.Mode = m.Mode
+		item.Owner = m.Owner()
+		item.ModTime = &m.ModTime
+		item.Hostname = m.Hostname
+		item.Cwd = m.Cwd
+		item.Cmdline = m.Cmdline
+		item.BatchID = m.ID
+		return item, nil
+	}
+
+	// older entries have only what can be seen in the trash
+	fsys = fsOrOS(fsys)
+	fi, err := fsys.Lstat(e.To)
+	if err != nil {
+		return ListItem{}, errors.Wrap(err, "lstat")
+	}
+	size, err := diskUsage(fsys, e.To)
+	if err != nil {
+		return ListItem{}, err
+	}
+	item.Size = size
+	item.Type = fileType(fi)
+	return item, nil
+}
+
+func fileType(fi os.FileInfo) string {
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return FileTypeSymlink
+	case fi.IsDir():
+		return FileTypeDir
+	case fi.Mode().IsRegular():
+		return FileTypeFile
+	default:
+		return FileTypeOther
+	}
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, string(filepath.Separator))
+	return path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator))
+}
+
+// ListEntries returns the items of the entries in fsys sorted by key.
+func ListEntries(fsys FileSystem, entries HistoryEntries, key string, reverse bool) ([]ListItem, error) {
+	compare, err := listComparator(key)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ListItem, 0, len(entries))
+	for _, e := range entries.Sorted() {
+		item, err := NewListItem(fsys, e)
+		if err != nil {
+			return nil, errors.Wrapf(err, "entry %v", e.To)
+		}
+		items = append(items, item)
+	}
+
+	slices.SortStableFunc(items, compare)
+	if reverse {
+		slices.Reverse(items)
+	}
+	return items, nil
+}
+
+func listComparator(key string) (func(a, b ListItem) int, error) {
+	switch key {
+	case "", ListSortRemoved:
+		return func(a, b ListItem) int { return a.Removed.Time().Compare(b.Removed.Time()) }, nil
+	case ListSortFrom:
+		return func(a, b ListItem) int { return cmp.Compare(a.From, b.From) }, nil
+	case ListSortTo:
+		return func(a, b ListItem) int { return cmp.Compare(a.To, b.To) }, nil
+	case ListSortSize:
+		return func(a, b ListItem) int { return cmp.Compare(a.Size, b.Size) }, nil
+	case ListSortID:
+		return func(a, b ListItem) int { return cmp.Compare(a.ID, b.ID) }, nil
+	case ListSortType:
+		return func(a, b ListItem) int { return cmp.Compare(a.Type, b.Type) }, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidSortKey, "%q (removed, from, to, size, id or type)", key)
+	}
+}
+
+// WriteList writes items in format.
+func WriteList(w io.Writer, items []ListItem, format string) error {
+	switch format {
+	case "", ListFormatTable:
+		return writeListTable(w, items)
+	case ListFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case ListFormatNDJSON:
+		return writeJSONLines(w, items)
+	case ListFormatCSV:
+		return writeListCSV(w, items)
+	default:
+		return errors.Wrapf(ErrInvalidListFormat, "%q (table, json, csv or ndjson)", format)
+	}
+}
+
+func writeListTable(w io.Writer, items []ListItem) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tREMOVED AT\tSIZE\tTYPE\tORIGINAL\tIN TRASH")
+	for _, item := range items {
+		id := item.ID
+		if item.Pinned {
+			id += "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			id, item.Removed, FormatSize(item.Size), item.Type, MapHomeToTilde(item.From), MapHomeToTilde(item.To))
+	}
+	return tw.Flush()
+}
+
+func writeListCSV(w io.Writer, items []ListItem) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"id", "from", "to", "removed_at", "size", "type", "pinned",
+		"mode", "owner", "mtime", "hostname", "cwd", "cmdline", "batch_id",
+	}
+	if err := cw.Write(header); err != nil {
+		return errors.Wrap(err, "write csv header")
+	}
+	for _, item := range items {
+		var mtime string
+		if item.ModTime != nil {
+			mtime = item.ModTime.Format(time.RFC3339)
+		}
+		record := []string{
+			item.ID, item.From, item.To, item.Removed.String(),
+			strconv.FormatInt(item.Size, 10), item.Type, strconv.FormatBool(item.Pinned),
+			item.Mode, item.Owner, mtime, item.Hostname, item.Cwd, Batch{Cmdline: item.Cmdline}.CommandLine(), item.BatchID,
+		}
+		if err := cw.Write(record); err != nil {
+			return errors.Wrap(err, "write csv")
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseTime parses an absolute time (RFC 3339, `2006-01-02T15:04:05` or `2006-01-02` in local time)
+// or an age such as `7d`, which means that long before now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	str := strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{DeletionDateFormat, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if age, err := ParseAge(str); err == nil {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, errors.Wrapf(ErrInvalidTime, "%q", s)
+}
@@ -0,0 +1,146 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: ゴミ箱の中にファイル・ディレクトリ・シンボリックリンクを用意する
+func listFixture(t *testing.T) lib.HistoryEntries {
+	t.Helper()
+	trashDir := t.TempDir()
+	base := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	file := filepath.Join(trashDir, "file.txt")
+	dir := filepath.Join(trashDir, "dir")
+	link := filepath.Join(trashDir, "link")
+	assert.NoError(t, os.WriteFile(file, []byte("12345"), 0644))
+	createDummyFile(t, filepath.Join(dir, "a", "b.txt"))
+	createDummyFile(t, filepath.Join(dir, "c.txt"))
+	assert.NoError(t, os.Symlink("file.txt", link))
+
+	return lib.HistoryEntries{
+		lib.NewHistoryEntry("/home/user/project/file.txt", file, lib.RemovedAt(base)),
+		lib.NewHistoryEntry("/home/user/project-old/dir", dir, lib.RemovedAt(base.Add(48*time.Hour))),
+		lib.NewHistoryEntry("/home/user/link", link, lib.RemovedAt(base.Add(24*time.Hour))),
+	}
+}
+
+func TestListEntries(t *testing.T) {
+	entries := listFixture(t)
+
+	items, err := lib.ListEntries(nil, entries, "", false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+
+	// デフォルトは削除日時の昇順
+	assert.Equal(t, "/home/user/project/file.txt", items[0].From)
+	assert.Equal(t, "/home/user/link", items[1].From)
+	assert.Equal(t, "/home/user/project-old/dir", items[2].From)
+
+	assert.Equal(t, entries[0].ID(), items[0].ID)
+	assert.Equal(t, lib.FileTypeFile, items[0].Type)
+	assert.Equal(t, int64(5), items[0].Size)
+	assert.Equal(t, lib.FileTypeSymlink, items[1].Type)
+	assert.Equal(t, lib.FileTypeDir, items[2].Type)
+	assert.Equal(t, int64(10), items[2].Size)
+
+	// サイズの降順（シンボリックリンクはリンク先のパスの長さ）
+	items, err = lib.ListEntries(nil, entries, lib.ListSortSize, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{lib.FileTypeDir, lib.FileTypeSymlink, lib.FileTypeFile},
+		[]string{items[0].Type, items[1].Type, items[2].Type})
+
+	_, err = lib.ListEntries(nil, entries, "unknown", false)
+	assert.ErrorIs(t, err, lib.ErrInvalidSortKey)
+}
+
+func TestHistoryQuery_Match(t *testing.T) {
+	entries := listFixture(t)
+	filter := func(q lib.HistoryQuery) []string {
+		froms := make([]string, 0)
+		for _, e := range entries {
+			if q.Match(e) {
+				froms = append(froms, e.From)
+			}
+		}
+		return froms
+	}
+
+	// 期間は [Since, Until)
+	assert.Equal(t, []string{"/home/user/link"}, filter(lib.HistoryQuery{
+		Since: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 1, 12, 12, 0, 0, 0, time.UTC),
+	}))
+
+	// プレフィックスはパスの区切りで判定する
+	assert.Equal(t, []string{"/home/user/project/file.txt"}, filter(lib.HistoryQuery{FromPrefix: "/home/user/project/"}))
+	assert.Equal(t, []string{"/home/user/link"}, filter(lib.HistoryQuery{From: "/home/user/link"}))
+}
+
+func TestWriteList(t *testing.T) {
+	items, err := lib.ListEntries(nil, listFixture(t), "", false)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, lib.WriteList(&buf, items, lib.ListFormatJSON))
+	var decoded []lib.ListItem
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, items, decoded)
+
+	buf.Reset()
+	assert.NoError(t, lib.WriteList(&buf, items, lib.ListFormatNDJSON))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	var first lib.ListItem
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, items[0], first)
+
+	buf.Reset()
+	assert.NoError(t, lib.WriteList(&buf, items, lib.ListFormatCSV))
+	records, err := csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"id", "from", "to", "removed_at", "size", "type", "pinned"}, records[0][:7])
+	assert.Equal(t, "2024-01-10T12:00:00Z", records[1][3])
+
+	buf.Reset()
+	assert.NoError(t, lib.WriteList(&buf, items, lib.ListFormatTable))
+	assert.Contains(t, buf.String(), items[0].ID)
+
+	assert.ErrorIs(t, lib.WriteList(&buf, items, "xml"), lib.ErrInvalidListFormat)
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	got, err := lib.ParseTime("2024-01-02T03:04:05Z", now)
+	assert.NoError(t, err)
+	assert.True(t, got.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	got, err = lib.ParseTime("2024-01-02", now)
+	assert.NoError(t, err)
+	assert.True(t, got.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)))
+
+	got, err = lib.ParseTime("2d", now)
+	assert.NoError(t, err)
+	assert.True(t, got.Equal(now.Add(-48*time.Hour)))
+
+	_, err = lib.ParseTime("yesterday", now)
+	assert.ErrorIs(t, err, lib.ErrInvalidTime)
+
+	// 範囲外の期間は遠い過去にならず、不正な時刻になる
+	for _, in := range []string{"NaNd", "Infd", "1e20d"} {
+		_, err = lib.ParseTime(in, now)
+		assert.ErrorIs(t, err, lib.ErrInvalidTime, in)
+	}
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	LockFileName       = "go-to-trash.lock"
+	DefaultLockTimeout = 10 * time.Second
+	lockRetryInterval  = 50 * time.Millisecond
+)
+
+var (
+	ErrLockTimeout = errors.New("timed out waiting for the lock")
+)
+
+// Lock is an advisory lock on a file, shared by every gototrash process.
+type Lock struct {
+	file *os.File
+}
+
+// AcquireLock blocks until the lock on path is acquired or timeout elapses.
+func AcquireLock(path string, timeout time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open lock file")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "failed to lock")
+		}
+		if ok {
+			return &Lock{file: f}, nil
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, errors.Wrapf(ErrLockTimeout, "%v is held by another gototrash process (waited %v)", path, timeout)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *Lock) Release() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return errors.Wrap(err, "failed to unlock")
+	}
+	return l.file.Close()
+}
+
+// LockTrashDir locks the history of trashDir for a load-modify-write transaction.
+func LockTrashDir(trashDir string, timeout time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(trashDir, 0777); err != nil {
+		return nil, errors.Wrap(err, "mkdirall")
+	}
+	return AcquireLock(filepath.Join(trashDir, LockFileName), timeout)
+}
@@ -0,0 +1,108 @@
+package lib_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// ロックが他で保持されている場合はタイムアウトでエラーになる
+func TestAcquireLock_Timeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lib.LockFileName)
+
+	lock, err := lib.AcquireLock(path, time.Second)
+	assert.NoError(t, err)
+
+	_, err = lib.AcquireLock(path, 100*time.Millisecond)
+	assert.ErrorIs(t, err, lib.ErrLockTimeout)
+
+	// 解放後は取得できる
+	assert.NoError(t, lock.Release())
+	lock, err = lib.AcquireLock(path, 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
+
+// 多数の goroutine から同時に Put と履歴の書き換えを行っても履歴が失われない
+func TestHistoryTrash_ConcurrentPut(t *testing.T) {
+	const n = 30
+	trashDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	// 後で復元する（=履歴の書き換えを起こす）ファイルを先にゴミ箱へ入れておく
+	restored := make([]lib.MovedFile, n)
+	for i := range n {
+		src := filepath.Join(srcDir, fmt.Sprintf("restored%d.txt", i))
+		createDummyFile(t, src)
+		movedFiles, err := lib.NewHistoryTrash(trashDir).Put([]string{src}, false)
+		assert.NoError(t, err)
+		restored[i] = movedFiles[0]
+	}
+
+	var wg sync.WaitGroup
+	for i := range n {
+		src := filepath.Join(srcDir, fmt.Sprintf("file%d.txt", i))
+		createDummyFile(t, src)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := lib.NewHistoryTrash(trashDir).Put([]string{src}, false)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, os.Rename(restored[i].To, restored[i].From))
+			_, err := lib.NewHistoryTrash(trashDir).Entries()
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	hist, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.NoError(t, hist.SyncHistory())
+	assert.Len(t, hist.Entries, n)
+}
+
+// 多数のプロセスから同時に Put しても履歴が失われない
+func TestHistoryTrash_ConcurrentPutProcesses(t *testing.T) {
+	const n = 10
+	trashDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	cmds := make([]*exec.Cmd, n)
+	for i := range n {
+		src := filepath.Join(srcDir, fmt.Sprintf("file%d.txt", i))
+		createDummyFile(t, src)
+
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcessPut$")
+		cmd.Env = append(os.Environ(), "GOTOTRASH_HELPER_TRASH_DIR="+trashDir, "GOTOTRASH_HELPER_PATH="+src)
+		assert.NoError(t, cmd.Start())
+		cmds[i] = cmd
+	}
+	for _, cmd := range cmds {
+		assert.NoError(t, cmd.Wait())
+	}
+
+	entries := readHistoryFile(t, filepath.Join(trashDir, lib.HistoryFileName))
+	assert.Len(t, entries, n)
+}
+
+// TestHelperProcessPut は TestHistoryTrash_ConcurrentPutProcesses から別プロセスとして実行される
+func TestHelperProcessPut(t *testing.T) {
+	trashDir := os.Getenv("GOTOTRASH_HELPER_TRASH_DIR")
+	if trashDir == "" {
+		t.Skip("helper process")
+	}
+
+	_, err := lib.NewHistoryTrash(trashDir).Put([]string{os.Getenv("GOTOTRASH_HELPER_PATH")}, false)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"strings"
+)
+
+// MatchEntries returns the entries which match pattern, the most recently removed first.
+// pattern is matched against the entry ID, the original path or the path in trash,
+// either exactly or as a glob. A glob without `/` is also matched against the base names.
+func MatchEntries(entries HistoryEntries, pattern string) HistoryEntries {
+	matched := make(HistoryEntries, 0)
+	for _, e := range entries {
+		if matchEntry(e, pattern) {
+			matched = append(matched, e)
+		}
+	}
+	return matched.Recent()
+}
+
+func matchEntry(e HistoryEntry, pattern string) bool {
+	if e.ID() == pattern {
+		return true
+	}
+
+	normalized, err := NormalizePath(pattern)
+	if err != nil {
+		normalized = pattern
+	}
+
+	for _, path := range []string{e.From, e.To} {
+		if path == normalized {
+			return true
+		}
+
+		if isGlob(pattern) && matchGlob(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
@@ -0,0 +1,62 @@
+package lib_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchEntries(t *testing.T) {
+	older := lib.HistoryEntry{
+		From:    "/source/path/file.txt",
+		To:      "/trash/file.txt",
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	newer := lib.HistoryEntry{
+		From:    "/source/path/file.txt",
+		To:      "/trash/file.20231002T000000Z.txt",
+		Removed: lib.RemovedAt(time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)),
+	}
+	other := lib.HistoryEntry{
+		From:    "/source/other/image.png",
+		To:      "/trash/image.png",
+		Removed: lib.RemovedAt(time.Date(2023, 10, 3, 0, 0, 0, 0, time.UTC)),
+	}
+	entries := lib.HistoryEntries{older, newer, other}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    lib.HistoryEntries
+	}{
+		// 元のパスの完全一致は新しい順に返る
+		{name: "exact from", pattern: "/source/path/file.txt", want: lib.HistoryEntries{newer, older}},
+		{name: "exact to", pattern: "/trash/image.png", want: lib.HistoryEntries{other}},
+		{name: "id", pattern: older.ID(), want: lib.HistoryEntries{older}},
+		{name: "glob with dir", pattern: "/source/*/*.png", want: lib.HistoryEntries{other}},
+		// `/` を含まない glob はファイル名にもマッチする
+		{name: "glob base name", pattern: "*.txt", want: lib.HistoryEntries{newer, older}},
+		{name: "no match", pattern: "/source/path/nothing.txt", want: nil},
+		// glob でなければファイル名だけでは一致しない
+		{name: "base name without glob", pattern: filepath.Join("..", "image.png"), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, lib.MatchEntries(entries, tt.pattern))
+		})
+	}
+}
+
+// ID は同じエントリに対して常に同じ値になり、エントリごとに異なる
+func TestHistoryEntry_ID(t *testing.T) {
+	e1 := lib.NewHistoryEntry("/a", "/trash/a", lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)))
+	e2 := lib.NewHistoryEntry("/a", "/trash/a", lib.RemovedAt(time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)))
+
+	assert.Len(t, e1.ID(), lib.HistoryEntryIDLength)
+	assert.Equal(t, e1.ID(), lib.NewHistoryEntry("/a", "/trash/a", e1.Removed).ID())
+	assert.NotEqual(t, e1.ID(), e2.ID())
+}
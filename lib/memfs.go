@@ -0,0 +1,338 @@
+package lib
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ FileSystem = (*MemFileSystem)(nil)
+
+// MemFileSystem keeps files in memory, for tests. It has no symlinks, so Lstat is the same as Stat.
+// Errors can be injected with Fail to test the failures which are hard to cause on disk.
+type MemFileSystem struct {
+	mu     sync.Mutex
+	nodes  map[string]*memNode
+	faults map[memFault]error
+}
+
+type memNode struct {
+	mode    fs.FileMode
+	data    []byte
+	modTime time.Time
+}
+
+type memFault struct {
+	op   string
+	path string
+}
+
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{
+		nodes:  make(map[string]*memNode),
+		faults: make(map[memFault]error),
+	}
+}
+
+// Fail makes op ("stat", "lstat", "rename", "mkdirall", "remove", "removeall" or "open") on path fail with err,
+// such as syscall.EXDEV. For rename, path is the old path. A nil err clears the fault.
+func (m *MemFileSystem) Fail(op, path string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memFault{op: op, path: filepath.Clean(path)}
+	if err == nil {
+		delete(m.faults, key)
+		return
+	}
+	m.faults[key] = err
+}
+
+// WriteFile creates or replaces the file name, whose parent must exist.
+func (m *MemFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := m.checkParent("open", name); err != nil {
+		return err
+	}
+	if n, ok := m.lookup(name); ok && n.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	m.nodes[name] = &memNode{mode: perm.Perm(), data: bytes.Clone(data), modTime: time.Now()}
+	return nil
+}
+
+// ReadFile returns the content of the file name.
+func (m *MemFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	n, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+	}
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return bytes.Clone(n.data), nil
+}
+
+func (m *MemFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return m.stat("stat", name)
+}
+
+func (m *MemFileSystem) Lstat(name string) (fs.FileInfo, error) {
+	return m.stat("lstat", name)
+}
+
+func (m *MemFileSystem) stat(op, name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := m.fault(op, name); err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	n, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+	}
+	return memFileInfo{name: filepath.Base(name), node: *n}, nil
+}
+
+func (m *MemFileSystem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	if err := m.fault("rename", oldpath); err != nil {
+		return linkErr(err)
+	}
+	src, ok := m.lookup(oldpath)
+	if !ok {
+		return linkErr(syscall.ENOENT)
+	}
+	if err := m.checkParent("rename", newpath); err != nil {
+		return linkErr(syscall.ENOENT)
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if isUnder(newpath, oldpath) {
+		return linkErr(syscall.EINVAL)
+	}
+	if dst, ok := m.lookup(newpath); ok {
+		switch {
+		case src.mode.IsDir() && !dst.mode.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case !src.mode.IsDir() && dst.mode.IsDir():
+			return linkErr(syscall.EISDIR)
+		case dst.mode.IsDir() && len(m.children(newpath)) > 0:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+
+	m.nodes[newpath] = src
+	delete(m.nodes, oldpath)
+	for _, child := range m.children(oldpath) {
+		m.nodes[newpath+strings.TrimPrefix(child, oldpath)] = m.nodes[child]
+		delete(m.nodes, child)
+	}
+	return nil
+}
+
+func (m *MemFileSystem) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if err := m.fault("mkdirall", path); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: path, Err: err}
+	}
+
+	// from the root to path
+	dirs := make([]string, 0)
+	for p := path; !isRoot(p); p = filepath.Dir(p) {
+		dirs = append(dirs, p)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		n, ok := m.lookup(dirs[i])
+		if !ok {
+			m.nodes[dirs[i]] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+			continue
+		}
+		if !n.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dirs[i], Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+func (m *MemFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := m.fault("remove", name); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if _, ok := m.lookup(name); !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOENT}
+	}
+	if len(m.children(name)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *MemFileSystem) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if err := m.fault("removeall", path); err != nil {
+		return &fs.PathError{Op: "unlinkat", Path: path, Err: err}
+	}
+	for _, child := range m.children(path) {
+		delete(m.nodes, child)
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+func (m *MemFileSystem) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := m.fault("open", name); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	n, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+	}
+	f := &memFile{info: memFileInfo{name: filepath.Base(name), node: *n}, r: bytes.NewReader(n.data)}
+	if n.mode.IsDir() {
+		for _, p := range m.children(name) {
+			if filepath.Dir(p) == name {
+				info := memFileInfo{name: filepath.Base(p), node: *m.nodes[p]}
+				f.dir = append(f.dir, fs.FileInfoToDirEntry(info))
+			}
+		}
+		slices.SortFunc(f.dir, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	}
+	return f, nil
+}
+
+// Readlink always fails since there are no symlinks.
+func (m *MemFileSystem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.lookup(name); !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.ENOENT}
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+}
+
+// lookup returns the node of the cleaned name. The root always exists.
+func (m *MemFileSystem) lookup(name string) (*memNode, bool) {
+	if isRoot(name) {
+		return &memNode{mode: fs.ModeDir | 0755}, true
+	}
+	n, ok := m.nodes[name]
+	return n, ok
+}
+
+func (m *MemFileSystem) checkParent(op, name string) error {
+	parent, ok := m.lookup(filepath.Dir(name))
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// children returns the paths under the cleaned dir.
+func (m *MemFileSystem) children(dir string) []string {
+	paths := make([]string, 0)
+	for p := range m.nodes {
+		if isUnder(p, dir) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func (m *MemFileSystem) fault(op, path string) error {
+	return m.faults[memFault{op: op, path: path}]
+}
+
+func isRoot(path string) bool {
+	return filepath.Dir(path) == path
+}
+
+// isUnder tells whether path is strictly under dir.
+func isUnder(path, dir string) bool {
+	if isRoot(dir) {
+		return path != dir
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+type memFileInfo struct {
+	name string
+	node memNode
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return int64(len(fi.node.data)) }
+func (fi memFileInfo) Mode() fs.FileMode  { return fi.node.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.node.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.node.mode.IsDir() }
+func (fi memFileInfo) Sys() any           { return nil }
+
+type memFile struct {
+	info memFileInfo
+	r    *bytes.Reader
+	// dir is the children not read yet, if the file is a directory
+	dir []fs.DirEntry
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *memFile) Read(b []byte) (int, error) {
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: syscall.EISDIR}
+	}
+	return f.r.Read(b)
+}
+
+// ReadDir reads the children by name like os.File.ReadDir.
+func (f *memFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: f.info.name, Err: syscall.ENOTDIR}
+	}
+	if n <= 0 {
+		entries := f.dir
+		f.dir = nil
+		return entries, nil
+	}
+	if len(f.dir) == 0 {
+		return nil, io.EOF
+	}
+	entries := f.dir[:min(n, len(f.dir))]
+	f.dir = f.dir[len(entries):]
+	return entries, nil
+}
+
+func (f *memFile) Close() error { return nil }
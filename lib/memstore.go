@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"slices"
+)
+
+var _ HistoryStore = (*MemoryHistoryStore)(nil)
+
+// MemoryHistoryStore keeps the history in memory only, for tests and dry runs.
+type MemoryHistoryStore struct {
+	entries HistoryEntries
+}
+
+func NewMemoryHistoryStore(entries ...HistoryEntry) *MemoryHistoryStore {
+	return &MemoryHistoryStore{entries: slices.Clone(entries)}
+}
+
+func (s *MemoryHistoryStore) Load() (HistoryEntries, error) {
+	return slices.Clone(s.entries), nil
+}
+
+func (s *MemoryHistoryStore) Append(entries []HistoryEntry) error {
+	if err := s.Remove(entries); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+func (s *MemoryHistoryStore) Remove(entries []HistoryEntry) error {
+	removed := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		removed[e.To] = struct{}{}
+	}
+	s.entries = slices.DeleteFunc(s.entries, func(e HistoryEntry) bool {
+		_, ok := removed[e.To]
+		return ok
+	})
+	return nil
+}
+
+func (s *MemoryHistoryStore) Query(q HistoryQuery) (HistoryEntries, error) {
+	matched := make(HistoryEntries, 0)
+	for _, e := range s.entries {
+		if q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+func (s *MemoryHistoryStore) Compact() error {
+	s.entries = UniqByKey(s.entries, func(e HistoryEntry) string { return e.To })
+	return nil
+}
+
+// Close keeps the entries, so that the store can be opened again by HistoryTrash.OpenStore.
+func (s *MemoryHistoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const BatchIDLength = 8
+
+// Metadata is what is known about a file and the command when it's trashed.
+// Entries recorded by older versions have none.
+type Metadata struct {
+	// Size is the total size of the files under it for directories.
+	Size int64  `json:"size"`
+	Type string `json:"type"`
+	// Mode is the permission bits in octal, such as `0644`.
+	Mode    string    `json:"mode"`
+	UID     int       `json:"uid"`
+	GID     int       `json:"gid"`
+	ModTime time.Time `json:"mtime"`
+
+	Batch
+}
+
+// Batch is the invocation which trashed a set of files together.
+type Batch struct {
+	ID       string   `json:"batch_id"`
+	Hostname string   `json:"hostname"`
+	Cwd      string   `json:"cwd"`
+	Cmdline  []string `json:"cmdline"`
+}
+
+// NewBatch describes the current process with a new random ID.
+func NewBatch() Batch {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("failed to get hostname: %v", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Printf("failed to get cwd: %v", err)
+	}
+
+	return Batch{
+		ID:       newBatchID(),
+		Hostname: hostname,
+		Cwd:      cwd,
+		Cmdline:  os.Args,
+	}
+}
+
+func newBatchID() string {
+	b := make([]byte, BatchIDLength/2)
+	if _, err := rand.Read(b); err != nil {
+		// unique enough within a trash even without randomness
+		return fmt.Sprintf("%08x", time.Now().UnixNano())[:BatchIDLength]
+	}
+	return hex.EncodeToString(b)
+}
+
+// collectMetadata reads the metadata of path before it's trashed.
+// It's best effort and never prevents the file from being trashed.
+func collectMetadata(fsys FileSystem, path string, batch Batch) *Metadata {
+	fi, err := fsys.Lstat(path)
+	if err != nil {
+		log.Printf("failed to collect metadata of %v: %v", path, err)
+		return nil
+	}
+
+	size := fi.Size()
+	if fi.IsDir() {
+		size, err = diskUsage(fsys, path)
+		if err != nil {
+			log.Printf("failed to get size of %v: %v", path, err)
+		}
+	}
+	uid, gid := fileOwner(fi)
+
+	return &Metadata{
+		Size:    size,
+		Type:    fileType(fi),
+		Mode:    octalMode(fi.Mode()),
+		UID:     uid,
+		GID:     gid,
+		ModTime: fi.ModTime(),
+		Batch:   batch,
+	}
+}
+
+func octalMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// Owner returns `uid:gid`, or an empty string if unknown.
+func (m *Metadata) Owner() string {
+	if m == nil || m.UID < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", m.UID, m.GID)
+}
+
+// CommandLine returns the command line as it would be typed.
+func (b Batch) CommandLine() string {
+	args := make([]string, len(b.Cmdline))
+	for i, arg := range b.Cmdline {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		args[i] = arg
+	}
+	return strings.Join(args, " ")
+}
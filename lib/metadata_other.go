@@ -0,0 +1,12 @@
+//go:build !unix
+
+package lib
+
+import (
+	"os"
+)
+
+// fileOwner is unknown since there is no uid/gid on this platform.
+func fileOwner(fi os.FileInfo) (int, int) {
+	return -1, -1
+}
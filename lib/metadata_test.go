@@ -0,0 +1,81 @@
+package lib_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// ゴミ箱に入れたときのメタデータが履歴に記録される
+func TestHistoryTrash_Metadata(t *testing.T) {
+	trashDir := t.TempDir()
+	trash := lib.NewHistoryTrash(trashDir)
+	srcDir := t.TempDir()
+
+	file := filepath.Join(srcDir, "file.txt")
+	dir := filepath.Join(srcDir, "dir")
+	createDummyFile(t, file)
+	createDummyFile(t, filepath.Join(dir, "a.txt"))
+	createDummyFile(t, filepath.Join(dir, "sub", "b.txt"))
+	assert.NoError(t, os.Chmod(file, 0640))
+
+	_, err := trash.Put([]string{file, dir}, false)
+	assert.NoError(t, err)
+
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, history.Entries, 2)
+
+	byFrom := make(map[string]lib.HistoryEntry)
+	for _, e := range history.Entries {
+		assert.NotNil(t, e.Metadata)
+		byFrom[e.From] = e
+	}
+
+	fm := byFrom[file].Metadata
+	assert.Equal(t, lib.FileTypeFile, fm.Type)
+	assert.Equal(t, int64(5), fm.Size)
+	assert.Equal(t, "0640", fm.Mode)
+	assert.Equal(t, os.Getuid(), fm.UID)
+	assert.False(t, fm.ModTime.IsZero())
+	assert.Len(t, fm.ID, lib.BatchIDLength)
+	assert.Equal(t, os.Args, fm.Cmdline)
+
+	cwd, _ := os.Getwd()
+	assert.Equal(t, cwd, fm.Cwd)
+
+	// ディレクトリのサイズは中身の合計
+	dm := byFrom[dir].Metadata
+	assert.Equal(t, lib.FileTypeDir, dm.Type)
+	assert.Equal(t, int64(10), dm.Size)
+
+	// 同時にゴミ箱に入れたものは同じバッチ
+	assert.Equal(t, fm.ID, dm.ID)
+}
+
+// メタデータのない古い形式の行も読み込める
+func TestLoadHistory_WithoutMetadata(t *testing.T) {
+	trashDir := t.TempDir()
+	line := `{"from":"/home/user/a.txt","to":"/trash/a.txt","removed_at":"2024-01-10T12:00:00Z"}` + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(trashDir, lib.HistoryFileName), []byte(line), 0644))
+
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, history.Entries, 1)
+	assert.Equal(t, "/home/user/a.txt", history.Entries[0].From)
+	assert.Nil(t, history.Entries[0].Metadata)
+
+	// 書き戻してもメタデータのキーは増えない
+	data, err := json.Marshal(history.Entries[0])
+	assert.NoError(t, err)
+	assert.JSONEq(t, line, string(data))
+}
+
+func TestBatch_CommandLine(t *testing.T) {
+	b := lib.Batch{Cmdline: []string{"gototrash", "-v", "my file.txt", "it's", "*.log"}}
+	assert.Equal(t, `gototrash -v 'my file.txt' 'it'\''s' '*.log'`, b.CommandLine())
+}
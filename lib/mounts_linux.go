@@ -0,0 +1,54 @@
+//go:build linux
+
+package lib
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+const procMounts = "/proc/self/mounts"
+
+// MountPoints returns the mount points listed in /proc/self/mounts.
+func MountPoints() ([]string, error) {
+	f, err := os.Open(procMounts)
+	if err != nil {
+		return nil, errors.Wrap(err, "open mounts")
+	}
+	defer f.Close()
+
+	mounts := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mounts = append(mounts, unescapeMountField(fields[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to scan mounts")
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountField decodes octal escapes such as `\040` for space.
+func unescapeMountField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package lib
+
+// MountPoints is only supported on Linux, so only the home trash is looked up elsewhere.
+func MountPoints() ([]string, error) {
+	return nil, nil
+}
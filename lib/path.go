@@ -39,13 +39,17 @@ func Home() string {
 }
 
 func ValidatePath(path string) (string, error) {
+	return validatePath(OSFileSystem{}, path)
+}
+
+func validatePath(fsys FileSystem, path string) (string, error) {
 	normPath, err := NormalizePath(path)
 	if err != nil {
 		return "", errors.Wrapf(errors.Join(err, ErrFileInternal), "normalize path: %v", path)
 	}
 
 	// check path existance
-	if _, err := os.Stat(normPath); err != nil {
+	if _, err := fsys.Stat(normPath); err != nil {
 		return "", errors.Wrap(errors.Join(err, ErrFileNotFound), "os stat")
 	}
 
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+)
+
+// MaxPreviewLines is the number of lines of a file or a directory listing shown in the preview.
+const MaxPreviewLines = 12
+
+// maxPreviewBytes is how much of a file is read for the preview.
+const maxPreviewBytes = 16 << 10
+
+// Preview describes the file or directory at path: its type, size and mode,
+// followed by the first lines of a text file or the children of a directory.
+func Preview(fsys FileSystem, path string, lines int) (string, error) {
+	fsys = fsOrOS(fsys)
+	fi, err := fsys.Lstat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "lstat")
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s  %v  %s\n", fileType(fi), fi.Mode(), fi.ModTime().Format(RemovedAtFormat)))
+
+	switch {
+	case fi.IsDir():
+		children, err := readDir(fsys, path)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(fmt.Sprintf("%d entries\n\n", len(children)))
+		for i, c := range children {
+			if i == lines {
+				b.WriteString(fmt.Sprintf("... and %d more\n", len(children)-lines))
+				break
+			}
+			name := c.Name()
+			if c.IsDir() {
+				name += "/"
+			}
+			b.WriteString(name + "\n")
+		}
+
+	case fi.Mode().IsRegular():
+		b.WriteString(FormatSize(fi.Size()) + "\n\n")
+		head, err := readHead(fsys, path, maxPreviewBytes)
+		if err != nil {
+			return "", err
+		}
+		if !isTextHead(head, fi.Size() > int64(len(head))) {
+			b.WriteString("(binary file)\n")
+			break
+		}
+		text := strings.ReplaceAll(string(head), "\t", "    ")
+		b.WriteString(truncateLines(text, lines, "...\n"))
+
+	default:
+		b.WriteString(FormatSize(fi.Size()) + "\n")
+	}
+	return b.String(), nil
+}
+
+func readDir(fsys FileSystem, path string) ([]fs.DirEntry, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open dir")
+	}
+	defer f.Close()
+
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, errors.Newf("cannot list %v", path)
+	}
+	children, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, errors.Wrap(err, "read dir")
+	}
+	return children, nil
+}
+
+func readHead(fsys FileSystem, path string, n int64) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	defer f.Close()
+
+	head, err := io.ReadAll(io.LimitReader(f, n))
+	if err != nil {
+		return nil, errors.Wrap(err, "read file")
+	}
+	return head, nil
+}
+
+// isTextHead is like !isBinary for the head of a file, which may end in the middle of a character if truncated.
+func isTextHead(head []byte, truncated bool) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	if truncated {
+		// drop the incomplete last character
+		for i := 1; i <= min(utf8.UTFMax, len(head)); i++ {
+			if tail := head[len(head)-i:]; utf8.RuneStart(tail[0]) {
+				if !utf8.FullRune(tail) {
+					head = head[:len(head)-i]
+				}
+				break
+			}
+		}
+	}
+	return utf8.Valid(head)
+}
@@ -0,0 +1,69 @@
+package lib_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview_Text(t *testing.T) {
+	fsys := lib.NewMemFileSystem()
+	lines := make([]string, 20)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	writeMemFile(t, fsys, "/trash/a.txt", strings.Join(lines, "\n"))
+
+	preview, err := lib.Preview(fsys, "/trash/a.txt", 3)
+	assert.NoError(t, err)
+	got := strings.Split(preview, "\n")
+	assert.True(t, strings.HasPrefix(got[0], "file  -rw-r--r--"), got[0])
+	assert.Equal(t, []string{"150B", "", "line 1", "line 2", "line 3", "...", ""}, got[1:])
+
+	// 短いファイルは全部見せる
+	writeMemFile(t, fsys, "/trash/b.txt", "hello")
+	preview, err = lib.Preview(fsys, "/trash/b.txt", 3)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(preview, "\n\nhello"), preview)
+}
+
+func TestPreview_Binary(t *testing.T) {
+	fsys := lib.NewMemFileSystem()
+	writeMemFile(t, fsys, "/trash/a.bin", "\x00\x01\x02")
+
+	preview, err := lib.Preview(fsys, "/trash/a.bin", 3)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(preview, "3B\n\n(binary file)\n"), preview)
+}
+
+func TestPreview_Dir(t *testing.T) {
+	fsys := lib.NewMemFileSystem()
+	for _, name := range []string{"c.txt", "a.txt", "b/child.txt", "d.txt"} {
+		writeMemFile(t, fsys, filepath.Join("/trash/dir", name), name)
+	}
+
+	// 名前順に並び、子の子は出さない
+	preview, err := lib.Preview(fsys, "/trash/dir", 3)
+	assert.NoError(t, err)
+	got := strings.Split(preview, "\n")
+	assert.True(t, strings.HasPrefix(got[0], "dir  drwxr-xr-x"), got[0])
+	assert.Equal(t, []string{"4 entries", "", "a.txt", "b/", "c.txt", "... and 1 more", ""}, got[1:])
+
+	_, err = lib.Preview(fsys, "/trash/missing", 3)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// ディスク上のファイル。読むのは先頭だけで、途中で切れた文字があってもテキストとみなす
+func TestPreview_LargeFileOnDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large.txt")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Repeat("あいう\n", 10000)), 0644))
+
+	preview, err := lib.Preview(nil, path, 2)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(preview, "\n\nあいう\nあいう\n...\n"), preview)
+}
@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const EvictionLogFileName = "go-to-trash-evicted.json"
+
+var (
+	ErrInvalidQuota   = errors.New("invalid quota")
+	ErrPinUnsupported = errors.New("pinning is not supported by this backend")
+)
+
+// Size is a number of bytes, which can be written as a number or a string such as "10G" in the config.
+type Size int64
+
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Size(n)
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return errors.Wrapf(ErrInvalidSize, "%s", data)
+	}
+	n, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+	return nil
+}
+
+// Quota limits each trash dir. Zero values don't limit.
+type Quota struct {
+	// MaxSize is the maximum total size of the entries in bytes.
+	MaxSize Size `json:"maxSize"`
+	// MaxSizePercent is the maximum total size of the entries in percent of the filesystem of the trash dir.
+	MaxSizePercent float64 `json:"maxSizePercent"`
+	// MaxEntries is the maximum number of entries.
+	MaxEntries int `json:"maxEntries"`
+}
+
+func (q Quota) IsZero() bool {
+	return q == Quota{}
+}
+
+func (q Quota) Validate() error {
+	if q.MaxSize < 0 || q.MaxEntries < 0 || q.MaxSizePercent < 0 || q.MaxSizePercent > 100 {
+		return errors.Wrapf(ErrInvalidQuota, "%+v", q)
+	}
+	return nil
+}
+
+// maxBytes returns the stricter of the size limits for a trash dir on a filesystem of fsSize bytes, or 0 if there is none.
+func (q Quota) maxBytes(fsSize int64) int64 {
+	limit := int64(q.MaxSize)
+	if q.MaxSizePercent > 0 && fsSize > 0 {
+		byPercent := int64(float64(fsSize) * q.MaxSizePercent / 100)
+		if limit == 0 || byPercent < limit {
+			limit = byPercent
+		}
+	}
+	return limit
+}
+
+// evictions returns the entries to be removed to keep the trash within the quota, the oldest first.
+// Pinned entries and the protected ones are never evicted, but still count toward the quota.
+func (q Quota) evictions(entries HistoryEntries, sizes map[string]int64, maxBytes int64, protected map[string]struct{}) HistoryEntries {
+	var total int64
+	for _, e := range entries {
+		total += sizes[e.To]
+	}
+	count := len(entries)
+
+	exceeded := func() bool {
+		return (maxBytes > 0 && total > maxBytes) || (q.MaxEntries > 0 && count > q.MaxEntries)
+	}
+
+	evicted := make(HistoryEntries, 0)
+	for _, e := range entries.Sorted() {
+		if !exceeded() {
+			break
+		}
+		if _, ok := protected[e.To]; ok || e.Pinned {
+			continue
+		}
+		evicted = append(evicted, e)
+		total -= sizes[e.To]
+		count--
+	}
+
+	if exceeded() {
+		log.Printf("the trash is still over the quota since the rest of the entries are pinned or have just been trashed")
+	}
+
+	return evicted
+}
+
+// EvictedEntry records an entry removed permanently to keep the trash within the quota.
+type EvictedEntry struct {
+	HistoryEntry
+	Size    int64     `json:"size"`
+	Evicted RemovedAt `json:"evicted_at"`
+}
+
+// enforceQuota evicts the oldest entries of the store in dir until it fits in the quota,
+// except for the ones just moved. The caller must hold the lock of dir.
+func enforceQuota(fsys FileSystem, store HistoryStore, dir string, quota Quota, movedFiles []MovedFile, now time.Time) (HistoryEntries, error) {
+	if quota.IsZero() {
+		return nil, nil
+	}
+
+	entries, err := query(fsys, store, HistoryQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(entries))
+	if quota.MaxSize > 0 || quota.MaxSizePercent > 0 {
+		for _, e := range entries {
+			// the size recorded when trashed saves walking the trash
+			if e.Metadata != nil {
+				sizes[e.To] = e.Metadata.Size
+				continue
+			}
+			size, err := diskUsage(fsys, e.To)
+			if err != nil {
+				return nil, errors.Wrapf(err, "size of %v", e.To)
+			}
+			sizes[e.To] = size
+		}
+	}
+
+	var fsSize int64
+	if quota.MaxSizePercent > 0 {
+		size, err := filesystemSize(dir)
+		if err != nil {
+			log.Printf("failed to get the size of the filesystem of %v, maxSizePercent is ignored: %v", dir, err)
+		}
+		fsSize = size
+	}
+
+	protected := make(map[string]struct{}, len(movedFiles))
+	for _, f := range movedFiles {
+		protected[f.To] = struct{}{}
+	}
+
+	candidates := quota.evictions(entries, sizes, quota.maxBytes(fsSize), protected)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	evicted := make(HistoryEntries, 0, len(candidates))
+	logged := make([]EvictedEntry, 0, len(candidates))
+	var errs []error
+	for _, e := range candidates {
+		// sizes are only known when the size is limited
+		if _, ok := sizes[e.To]; !ok {
+			sizes[e.To], _ = diskUsage(fsys, e.To)
+		}
+		if err := fsys.RemoveAll(e.To); err != nil {
+			errs = append(errs, errors.Wrapf(err, "evict %v", e.To))
+			continue
+		}
+		log.Printf("evicted: %v (%v, removed at %v) ← %v", e.To, FormatSize(sizes[e.To]), e.Removed, e.From)
+		evicted = append(evicted, e)
+		logged = append(logged, EvictedEntry{HistoryEntry: e, Size: sizes[e.To], Evicted: RemovedAt(now)})
+	}
+
+	if err := store.Remove(evicted); err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to update history"))
+	}
+	if err := appendEvictionLog(dir, logged); err != nil {
+		errs = append(errs, err)
+	}
+
+	return evicted, errors.Join(errs...)
+}
+
+// appendEvictionLog appends entries to the eviction log in dir.
+func appendEvictionLog(dir string, entries []EvictedEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, EvictionLogFileName), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open eviction log")
+	}
+	defer f.Close()
+
+	if err := terminateLastLine(f); err != nil {
+		return err
+	}
+	if err := writeJSONLines(f, entries); err != nil {
+		return errors.Wrap(err, "failed to write eviction log")
+	}
+
+	return f.Sync()
+}
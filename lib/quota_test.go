@@ -0,0 +1,122 @@
+package lib_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: ファイルを1つずつ作ってゴミ箱に入れる
+func putFiles(t *testing.T, trash lib.Trash, names ...string) {
+	t.Helper()
+	srcDir := t.TempDir()
+	for _, name := range names {
+		src := filepath.Join(srcDir, name)
+		createDummyFile(t, src)
+		_, err := trash.Put([]string{src}, false)
+		assert.NoError(t, err)
+	}
+}
+
+func readEvictionLog(t *testing.T, path string) []lib.EvictedEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var entries []lib.EvictedEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e lib.EvictedEntry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func baseNames(entries lib.HistoryEntries) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = filepath.Base(e.To)
+	}
+	return names
+}
+
+// エントリ数の上限を超えたら古いものから削除され、ログに残る
+func TestHistoryTrash_QuotaMaxEntries(t *testing.T) {
+	trashDir := t.TempDir()
+	trash := lib.NewHistoryTrash(trashDir)
+	trash.Quota = lib.Quota{MaxEntries: 2}
+
+	putFiles(t, trash, "a.txt", "b.txt", "c.txt")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b.txt", "c.txt"}, baseNames(entries))
+	assert.NoFileExists(t, filepath.Join(trashDir, "a.txt"))
+
+	evicted := readEvictionLog(t, filepath.Join(trashDir, lib.EvictionLogFileName))
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, filepath.Join(trashDir, "a.txt"), evicted[0].To)
+	assert.Equal(t, int64(5), evicted[0].Size)
+}
+
+// サイズの上限を超えたら古いものから削除される
+func TestHistoryTrash_QuotaMaxSize(t *testing.T) {
+	trash := lib.NewHistoryTrash(t.TempDir())
+	// createDummyFile は "dummy" (5 bytes) を書き込む
+	trash.Quota = lib.Quota{MaxSize: 12}
+
+	putFiles(t, trash, "a.txt", "b.txt", "c.txt")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b.txt", "c.txt"}, baseNames(entries))
+}
+
+// ピン留めしたエントリは削除されない
+func TestHistoryTrash_QuotaPinned(t *testing.T) {
+	trash := lib.NewHistoryTrash(t.TempDir())
+	putFiles(t, trash, "a.txt", "b.txt")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.NoError(t, trash.Pin(lib.MatchEntries(entries, "a.tx[t]"), true))
+
+	trash.Quota = lib.Quota{MaxEntries: 2}
+	putFiles(t, trash, "c.txt")
+
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "c.txt"}, baseNames(entries))
+	assert.True(t, entries[0].Pinned)
+}
+
+// 今回ゴミ箱に入れたファイルは上限を超えていても削除されない
+func TestHistoryTrash_QuotaKeepsJustMoved(t *testing.T) {
+	trash := lib.NewHistoryTrash(t.TempDir())
+	trash.Quota = lib.Quota{MaxSize: 1}
+
+	putFiles(t, trash, "a.txt")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, baseNames(entries))
+}
+
+func TestSize_UnmarshalJSON(t *testing.T) {
+	var q lib.Quota
+	assert.NoError(t, json.Unmarshal([]byte(`{"maxSize": "1G", "maxSizePercent": 10, "maxEntries": 100}`), &q))
+	assert.Equal(t, lib.Quota{MaxSize: 1 << 30, MaxSizePercent: 10, MaxEntries: 100}, q)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"maxSize": 2048}`), &q))
+	assert.Equal(t, lib.Size(2048), q.MaxSize)
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"maxSize": "lots"}`), &q), lib.ErrInvalidSize)
+	assert.ErrorIs(t, lib.Quota{MaxSizePercent: 120}.Validate(), lib.ErrInvalidQuota)
+}
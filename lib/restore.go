@@ -2,28 +2,112 @@ package lib
 
 import (
 	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/cursor"
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/cockroachdb/errors"
 )
 
 var baseStyle = lipgloss.NewStyle().
 	BorderStyle(lipgloss.NormalBorder()).
 	BorderForeground(lipgloss.Color("240"))
 
+var chipStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("0")).
+	Background(lipgloss.Color("6")).
+	Padding(0, 1)
+
 var _ tea.Model = (*model)(nil)
 
-type errMsg struct {
-	err error
+type model struct {
+	table   table.Model
+	trash   Trash
+	opts    RestoreOptions
+	entries HistoryEntries
+	rows    []row
+	byBatch bool
+	// versionsOf is the original path whose versions are shown instead of all the entries, if not empty
+	versionsOf string
+	// versions is the number of entries of each original path
+	versions map[string]int
+	selected map[string]HistoryEntry
+	message  string
+	// conflicts waiting for an answer when the conflict policy is ask
+	conflicts []RestoreConflict
+	answers   map[string]ConflictPolicy
+	// purging is the entries waiting for the confirmation of permanent deletion
+	purging HistoryEntries
+	// diff is shown instead of the details while the cursor is on the entry diffOf
+	diff   string
+	diffOf string
+	// width is the width of the window, 0 until known
+	width        int
+	showPreview  bool
+	previewWidth int
+	// preview is shared by the copies of the model so that View can cache it
+	preview *previewCache
+	// filter narrows the rows down, and is edited in search while searching
+	filter    Filter
+	search    textinput.Model
+	searching bool
+	// filterErr is the error of the last chip typed, if it's invalid
+	filterErr string
+	// ranging is true while marking a range of rows from the row anchor to the cursor
+	ranging bool
+	anchor  int
+	// failed is the error of each entry the last restore failed to move, keyed by the path in trash
+	failed map[string]error
+	// restoreErr is the error of the last restore which is not about a file, such as a conflict
+	restoreErr error
 }
 
-type model struct {
-	table      table.Model
-	pathToFile map[string]HistoryEntry
-	selected   map[string]HistoryEntry
-	message    string
+// previewCache is the preview of the row under the cursor, computed again when the cursor moves.
+type previewCache struct {
+	key  string
+	text string
+}
+
+// row is what a row of the table shows: an entry, or all the entries of a batch when grouped by batch.
+type row struct {
+	entry HistoryEntry
+	batch *BatchEntries
+}
+
+func (r row) entries() HistoryEntries {
+	if r.batch != nil {
+		return r.batch.Entries
+	}
+	return HistoryEntries{r.entry}
+}
+
+// RestoreOptions changes where and how entries are restored.
+type RestoreOptions struct {
+	// Dir is the directory to restore into instead of the original location, if not empty.
+	Dir      string
+	IsDryRun bool
+	// Conflict is what to do when the destination already exists.
+	Conflict ConflictPolicy
+	// Ask is called for each conflict when Conflict is ConflictAsk.
+	Ask func(RestoreConflict) (ConflictPolicy, error)
+	// FS is where the files are moved, the OS file system if nil.
+	FS FileSystem
+}
+
+// RestoredFile is a file moved back from the trash.
+type RestoredFile struct {
+	MovedFile
+	// Renamed is true when the file has been restored under another name because of a conflict.
+	Renamed bool
+	// Overwritten is where the file which was at the destination has been trashed, if any.
+	Overwritten string
 }
 
 const (
@@ -31,48 +115,169 @@ const (
 	ColTitlePathInTrash = "Path in Trash"
 	ColTitlePathInOrig  = "Path in Orig."
 	ColTitleRemovedAt   = "RemovedAt."
+	ColTitleID          = "ID"
+	ColTitleSize        = "Size"
 )
 
 const (
 	ColBaseWidthForMark      = 4
 	ColBaseWidthForRemovedAt = 20
 	ColBaseWidthForPath      = 20
+	ColBaseWidthForID        = HistoryEntryIDLength
+	ColBaseWidthForSize      = 7
+	ColBaseWidthForPreview   = 40
 	TableBorderWidth         = 6
 )
 
+// MaxBatchDetails is the number of entries listed in the details of a batch.
+const MaxBatchDetails = 5
+
+// MaxDiffLines is the number of lines of the diff shown under the table.
+const MaxDiffLines = 20
+
 var columns = []table.Column{
 	{Title: ColTitleMark, Width: ColBaseWidthForMark},
 	{Title: ColTitlePathInTrash, Width: ColBaseWidthForPath},
 	{Title: ColTitlePathInOrig, Width: ColBaseWidthForPath},
 	{Title: ColTitleRemovedAt, Width: ColBaseWidthForRemovedAt},
+	{Title: ColTitleID, Width: ColBaseWidthForID},
+	{Title: ColTitleSize, Width: ColBaseWidthForSize},
 }
 
-func newModel(entries HistoryEntries) model {
-	sortedEntries := entries.Sorted()
-
-	rows := make([]table.Row, len(sortedEntries))
-	for i, f := range sortedEntries {
-		rows[i] = []string{"", MapHomeToTilde(f.To), MapHomeToTilde(f.From), f.Removed.String()}
-	}
-
+func newModel(trash Trash, entries HistoryEntries, opts RestoreOptions) model {
 	t := table.New(
 		table.WithColumns(columns),
-		table.WithRows(rows),
 		table.WithFocused(true),
 		table.WithHeight(7),
 	)
 
-	pathToFile := make(map[string]HistoryEntry, len(sortedEntries))
-	for _, e := range sortedEntries {
-		// key is unique path in trash
-		pathToFile[MapHomeToTilde(e.To)] = e
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "fuzzy search, since:7d until:2024-01-01 in:~/dir"
+	search.Width = 60
+	search.Cursor.SetMode(cursor.CursorStatic)
+
+	m := model{
+		table:    t,
+		trash:    trash,
+		opts:     opts,
+		entries:  entries.Sorted(),
+		selected: make(map[string]HistoryEntry),
+
+		showPreview:  true,
+		previewWidth: ColBaseWidthForPreview,
+		preview:      &previewCache{},
+		search:       search,
+	}
+	m.refresh()
+	return m
+}
+
+// refresh rebuilds the rows from the entries and the marks.
+func (m *model) refresh() {
+	m.versions = CountVersions(m.entries)
+	m.rows = make([]row, 0, len(m.entries))
+	switch {
+	case m.versionsOf != "":
+		// all the versions regardless of the filter
+		for _, e := range Versions(m.entries, m.versionsOf) {
+			m.rows = append(m.rows, row{entry: e})
+		}
+	case m.byBatch:
+		batches := GroupByBatch(m.filter.Apply(m.entries))
+		// from the oldest like the entries
+		for i := len(batches) - 1; i >= 0; i-- {
+			m.rows = append(m.rows, row{batch: &batches[i]})
+		}
+	default:
+		for _, e := range m.filter.Apply(m.entries) {
+			m.rows = append(m.rows, row{entry: e})
+		}
+	}
+
+	m.anchor = min(m.anchor, max(len(m.rows)-1, 0))
+
+	tableRows := make([]table.Row, len(m.rows))
+	for i, r := range m.rows {
+		tableRows[i] = m.tableRow(r)
+		if m.inRange(i) {
+			tableRows[i][0] = ">" + tableRows[i][0]
+		}
+	}
+	m.table.SetRows(tableRows)
+	m.table.SetCursor(m.table.Cursor())
+}
+
+// inRange is true if the row i is in the range being marked.
+func (m model) inRange(i int) bool {
+	if !m.ranging {
+		return false
+	}
+	cursor := m.table.Cursor()
+	return min(m.anchor, cursor) <= i && i <= max(m.anchor, cursor)
+}
+
+func (m model) tableRow(r row) table.Row {
+	mark := m.mark(r)
+	for _, e := range r.entries() {
+		if _, ok := m.failed[e.To]; ok {
+			mark += "!"
+			break
+		}
+	}
+
+	if r.batch == nil {
+		e := r.entry
+		return table.Row{mark, MapHomeToTilde(e.To), MapHomeToTilde(e.From), e.Removed.String(), e.ID(), entrySize(e)}
+	}
+
+	b := r.batch
+	names := make([]string, len(b.Entries))
+	froms := make([]string, len(b.Entries))
+	for i, e := range b.Entries {
+		names[i] = filepath.Base(e.To)
+		froms[i] = e.From
+	}
+	id := b.ID
+	if id == "" {
+		id = "-"
+	}
+	return table.Row{
+		mark,
+		fmt.Sprintf("%d entries: %s", len(b.Entries), strings.Join(names, ", ")),
+		MapHomeToTilde(commonDir(froms)),
+		RemovedAt(b.Removed()).String(),
+		id,
+		batchSize(*b),
+	}
+}
+
+// mark is `x` if all the entries of the row are marked, and `-` if some of them are.
+func (m model) mark(r row) string {
+	entries := r.entries()
+	marked := 0
+	for _, e := range entries {
+		if _, ok := m.selected[e.To]; ok {
+			marked++
+		}
+	}
+	switch {
+	case marked == 0:
+		return ""
+	case marked == len(entries):
+		return "x"
+	default:
+		return "-"
 	}
+}
 
-	return model{
-		table:      t,
-		pathToFile: pathToFile,
-		selected:   make(map[string]HistoryEntry),
+// current returns the row under the cursor.
+func (m model) current() (row, bool) {
+	i := m.table.Cursor()
+	if i < 0 || i >= len(m.rows) {
+		return row{}, false
 	}
+	return m.rows[i], true
 }
 
 func (m model) Init() tea.Cmd {
@@ -83,30 +288,108 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	// resize table width
 	case tea.WindowSizeMsg:
-		availableWidth := msg.Width - (TableBorderWidth * 2)
-		return m.updateColumnWidths(availableWidth)
+		m.width = msg.Width
+		return m.resize()
 
 	// handle key input
 	case tea.KeyMsg:
+		if len(m.conflicts) > 0 {
+			return m.answer(msg.String())
+		}
+		if len(m.purging) > 0 {
+			return m.confirmPurge(msg.String())
+		}
+		if m.searching {
+			return m.updateSearch(msg)
+		}
+
 		// execute command
 		switch msg.String() {
 		case "ctrl+c", "ctrl+g", "q":
 			return m, tea.Quit
 		case "ctrl+m", "ctrl+j", "enter", " ":
+			if m.ranging {
+				return m.markRange()
+			}
 			return m.update()
+		case "a":
+			return m.markAll()
+		case "i":
+			return m.invertMarks()
+		case "V":
+			return m.markRange()
+		case "b":
+			m.byBatch = !m.byBatch
+			m.refresh()
+			return m, nil
+		case "v":
+			return m.toggleVersions()
+		case "d":
+			return m.toggleDiff()
+		case "p":
+			m.showPreview = !m.showPreview
+			return m.resize()
+		case "/":
+			// search all the entries
+			m.versionsOf = ""
+			m.searching = true
+			m.refresh()
+			return m, m.search.Focus()
+		case "esc":
+			if m.ranging {
+				m.ranging = false
+				m.refresh()
+				return m, nil
+			}
+			if m.versionsOf != "" {
+				return m.toggleVersions()
+			}
+			if !m.filter.IsZero() {
+				return m.clearFilter()
+			}
 		case "X":
 			return m.restore()
+		case "r":
+			if len(m.failed) > 0 || m.restoreErr != nil {
+				return m.restore()
+			}
+		case "D":
+			return m.purge()
 		}
 	}
 
 	// handle undefined key input
 	var cmd tea.Cmd
 	m.table, cmd = m.table.Update(msg)
+	if m.ranging {
+		// the range follows the cursor
+		m.refresh()
+	}
 	return m, cmd
 }
 
+// resize splits the width of the window between the table and the preview.
+func (m model) resize() (tea.Model, tea.Cmd) {
+	if m.width == 0 {
+		return m, nil
+	}
+	availableWidth := m.width - (TableBorderWidth * 2)
+	m.previewWidth = 0
+	if m.showPreview {
+		// the preview has its own border and the margin of the table
+		previewWidth := max(availableWidth/3, ColBaseWidthForPreview)
+		minTableWidth := ColBaseWidthForMark + ColBaseWidthForRemovedAt + ColBaseWidthForID + ColBaseWidthForSize + ColBaseWidthForPath*2
+		// no room for the preview in a narrow window
+		if availableWidth-previewWidth-3 >= minTableWidth {
+			m.previewWidth = previewWidth
+			availableWidth -= previewWidth + 3
+		}
+	}
+	return m.updateColumnWidths(availableWidth)
+}
+
 func (m model) updateColumnWidths(availableWidth int) (tea.Model, tea.Cmd) {
-	remainingWidth := availableWidth - ColBaseWidthForMark - ColBaseWidthForRemovedAt
+	remainingWidth := availableWidth - ColBaseWidthForMark - ColBaseWidthForRemovedAt - ColBaseWidthForID - ColBaseWidthForSize
 	pathWidth := remainingWidth / 2
 
 	if pathWidth < ColBaseWidthForPath {
@@ -124,6 +407,10 @@ func (m model) updateColumnWidths(availableWidth int) (tea.Model, tea.Cmd) {
 			w = ColBaseWidthForMark
 		case ColTitleRemovedAt:
 			w = ColBaseWidthForRemovedAt
+		case ColTitleID:
+			w = ColBaseWidthForID
+		case ColTitleSize:
+			w = ColBaseWidthForSize
 		default:
 			panic("unknown column")
 		}
@@ -135,59 +422,581 @@ func (m model) updateColumnWidths(availableWidth int) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// update toggles the mark of the row under the cursor. A batch is marked when any of its entries is not.
 func (m model) update() (tea.Model, tea.Cmd) {
-	r := m.table.SelectedRow()
-	pathInTrash := r[1]
-	if _, ok := m.selected[pathInTrash]; ok {
-		delete(m.selected, pathInTrash)
+	r, ok := m.current()
+	if !ok {
+		return m, nil
+	}
+
+	entries := r.entries()
+	if m.mark(r) == "x" {
+		for _, e := range entries {
+			delete(m.selected, e.To)
+		}
 	} else {
-		f := m.pathToFile[pathInTrash]
-		m.selected[pathInTrash] = f
+		for _, e := range entries {
+			m.selected[e.To] = e
+		}
 	}
 
-	return m.updateRow()
+	m.refresh()
+	return m, nil
 }
 
-func (m model) updateRow() (tea.Model, tea.Cmd) {
-	// toggle mark of selected raw
-	r := m.table.SelectedRow()
-	switch r[0] {
-	case "":
-		r[0] = "x"
-	default:
-		r[0] = ""
+// updateSearch edits the search, filtering the rows as it changes.
+// The completed words which are chips such as `since:7d` become chips.
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "ctrl+g":
+		return m.clearFilter()
+	case "enter":
+		m.takeChips(true)
+		m.searching = false
+		m.search.Blur()
+		return m.applyFilter()
+	case "up", "down", "pgup", "pgdown":
+		// move the cursor while searching
+		var cmd tea.Cmd
+		m.table, cmd = m.table.Update(msg)
+		return m, cmd
+	case "backspace":
+		if m.search.Value() == "" && len(m.filter.Chips) > 0 {
+			m.filter.Chips = m.filter.Chips[:len(m.filter.Chips)-1]
+			return m.applyFilter()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	m.takeChips(false)
+	next, _ := m.applyFilter()
+	return next, cmd
+}
+
+// takeChips turns the chips typed in search into chips of the filter. The last word is taken only if it's completed.
+func (m *model) takeChips(all bool) {
+	value := m.search.Value()
+	words := strings.Fields(value)
+	if !all && len(words) > 0 && !strings.HasSuffix(value, " ") {
+		// still typing
+		words = words[:len(words)-1]
+	}
+
+	taken := make(map[string]bool)
+	m.filterErr = ""
+	for _, word := range words {
+		chip, ok, err := ParseFilterChip(word, time.Now())
+		switch {
+		case !ok:
+		case err != nil:
+			m.filterErr = err.Error()
+		default:
+			m.filter.Chips = append(m.filter.Chips, chip)
+			taken[word] = true
+		}
+	}
+	if len(taken) == 0 {
+		return
+	}
+
+	rest := make([]string, 0)
+	for _, word := range strings.Fields(value) {
+		if !taken[word] {
+			rest = append(rest, word)
+		}
+	}
+	m.search.SetValue(strings.Join(rest, " "))
+}
+
+// applyFilter filters the rows by the search and the chips, from the top.
+func (m model) applyFilter() (tea.Model, tea.Cmd) {
+	m.filter.Pattern = m.search.Value()
+	m.table.SetCursor(0)
+	m.refresh()
+	return m, nil
+}
+
+// clearFilter shows all the entries again. The marks are kept.
+func (m model) clearFilter() (tea.Model, tea.Cmd) {
+	m.filter = Filter{}
+	m.filterErr = ""
+	m.search.SetValue("")
+	m.searching = false
+	m.search.Blur()
+	return m.applyFilter()
+}
+
+// visible returns the entries of all the rows shown.
+func (m model) visible() HistoryEntries {
+	entries := make(HistoryEntries, 0, len(m.rows))
+	for _, r := range m.rows {
+		entries = append(entries, r.entries()...)
+	}
+	return entries
+}
+
+// markAll marks all the rows shown, or unmarks them if they're all marked already.
+func (m model) markAll() (tea.Model, tea.Cmd) {
+	entries := m.visible()
+	all := true
+	for _, e := range entries {
+		if _, ok := m.selected[e.To]; !ok {
+			all = false
+			break
+		}
+	}
+
+	for _, e := range entries {
+		if all {
+			delete(m.selected, e.To)
+		} else {
+			m.selected[e.To] = e
+		}
+	}
+	m.refresh()
+	return m, nil
+}
+
+// invertMarks marks the entries shown which are not marked and unmarks the others.
+// The marks hidden by the filter are kept.
+func (m model) invertMarks() (tea.Model, tea.Cmd) {
+	for _, e := range m.visible() {
+		if _, ok := m.selected[e.To]; ok {
+			delete(m.selected, e.To)
+		} else {
+			m.selected[e.To] = e
+		}
+	}
+	m.refresh()
+	return m, nil
+}
+
+// markRange starts a range at the cursor, or marks the rows from the start to the cursor.
+func (m model) markRange() (tea.Model, tea.Cmd) {
+	if !m.ranging {
+		if _, ok := m.current(); !ok {
+			return m, nil
+		}
+		m.ranging = true
+		m.anchor = m.table.Cursor()
+		m.refresh()
+		return m, nil
 	}
 
-	rows := m.table.Rows()
-	rows[m.table.Cursor()] = r
-	m.table.SetRows(rows)
+	for i, r := range m.rows {
+		if m.inRange(i) {
+			for _, e := range r.entries() {
+				m.selected[e.To] = e
+			}
+		}
+	}
+	m.ranging = false
+	m.refresh()
 	return m, nil
 }
 
+// toggleVersions shows the versions of the path of the entry under the cursor, or all the entries again.
+func (m model) toggleVersions() (tea.Model, tea.Cmd) {
+	if m.versionsOf != "" {
+		m.versionsOf = ""
+		m.refresh()
+		return m, nil
+	}
+
+	r, ok := m.current()
+	if !ok || r.batch != nil {
+		return m, nil
+	}
+	m.versionsOf = r.entry.From
+	m.table.SetCursor(0)
+	m.refresh()
+	return m, nil
+}
+
+// toggleDiff shows the diff of the entry under the cursor against its original path, or hides it.
+func (m model) toggleDiff() (tea.Model, tea.Cmd) {
+	r, ok := m.current()
+	if !ok || r.batch != nil {
+		return m, nil
+	}
+	if m.diffOf == r.entry.To {
+		m.diff, m.diffOf = "", ""
+		return m, nil
+	}
+
+	var b strings.Builder
+	diffs, err := DiffEntry(m.opts.FS, r.entry)
+	if err == nil {
+		err = WriteDiff(&b, r.entry, diffs)
+	}
+	if err != nil {
+		m.diff = fmt.Sprintf("failed to diff: %v\n", err)
+	} else {
+		m.diff = truncateLines(b.String(), MaxDiffLines,
+			fmt.Sprintf("... run `gototrash diff %s` to see the whole diff\n", r.entry.ID()))
+	}
+	m.diffOf = r.entry.To
+	return m, nil
+}
+
+// marked returns the marked entries from the oldest.
+func (m model) marked() HistoryEntries {
+	entries := make(HistoryEntries, 0, len(m.selected))
+	for _, entry := range m.selected {
+		entries = append(entries, entry)
+	}
+	// the entries of a batch share the removal time
+	slices.SortFunc(entries, func(a, b HistoryEntry) int { return strings.Compare(a.To, b.To) })
+	return entries.Sorted()
+}
+
+// restore moves the marked entries back, and quits if all of them have been restored.
+// Otherwise it keeps running with the entries which failed still marked, so that they can be restored again.
 func (m model) restore() (tea.Model, tea.Cmd) {
 	if len(m.selected) == 0 {
-		return nil, nil
+		m.message = "Nothing is marked. Mark the entries to restore with space.\n"
+		return m, nil
 	}
 
 	// restore marked files
-	ToBeMovedFiles := make(ToBeMovedFiles, 0, len(m.selected))
-	for _, entry := range m.selected {
-		// invert `from` and `to` for restore
-		ToBeMovedFiles = append(ToBeMovedFiles, NewToBeMovedFile(entry.To, entry.From))
+	entries := m.marked()
+
+	opts := m.opts
+	if opts.Conflict == ConflictAsk {
+		// ask for every conflict before restoring anything
+		if m.answers == nil {
+			m.conflicts = RestoreConflicts(entries, opts)
+			m.answers = make(map[string]ConflictPolicy, len(m.conflicts))
+			if len(m.conflicts) > 0 {
+				return m, nil
+			}
+		}
+		answers := m.answers
+		opts.Ask = func(c RestoreConflict) (ConflictPolicy, error) {
+			if answer, ok := answers[c.Entry.To]; ok {
+				return answer, nil
+			}
+			return ConflictSkip, nil
+		}
+	}
+
+	restoredFiles, err := RestoreEntries(m.trash, entries, opts)
+	// ask again on retry
+	m.answers = nil
+
+	m.message = ""
+	for _, f := range restoredFiles {
+		m.message += formatRestoredFile(f) + "\n"
+	}
+	if !opts.IsDryRun {
+		gone := make(map[string]struct{}, len(restoredFiles))
+		for _, f := range restoredFiles {
+			gone[f.From] = struct{}{}
+			delete(m.selected, f.From)
+		}
+		m.drop(gone)
+	}
+	if err == nil {
+		m.failed = nil
+		m.restoreErr = nil
+		return m, tea.Quit
+	}
+
+	m.failed = make(map[string]error)
+	for _, fe := range FileErrors(err) {
+		m.failed[fe.From] = fe.Err
 	}
+	m.restoreErr = nil
+	if len(m.failed) == 0 {
+		m.restoreErr = err
+	}
+
+	m.refresh()
+	return m, nil
+}
+
+// purge asks for the confirmation to delete the marked entries permanently,
+// or the entries of the row under the cursor if none is marked.
+func (m model) purge() (tea.Model, tea.Cmd) {
+	if len(m.selected) > 0 {
+		m.purging = m.marked()
+		return m, nil
+	}
+	if r, ok := m.current(); ok {
+		m.purging = r.entries()
+	}
+	return m, nil
+}
 
-	movedFiles, err := ToBeMovedFiles.Move(false)
+// confirmPurge deletes the entries waiting for the confirmation if key is yes, and keeps the UI running.
+func (m model) confirmPurge(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "y", "Y":
+	case "ctrl+c":
+		return m, tea.Quit
+	default:
+		// anything but yes is no
+		m.purging = nil
+		return m, nil
+	}
+
+	if m.opts.IsDryRun {
+		m.message = fmt.Sprintf("would delete %d entries\n", len(m.purging))
+		m.purging = nil
+		return m, nil
+	}
+
+	purged, err := m.trash.Purge(m.purging)
+	m.purging = nil
+
+	gone := make(map[string]struct{}, len(purged))
+	m.message = ""
+	for _, e := range purged {
+		gone[e.To] = struct{}{}
+		delete(m.selected, e.To)
+		m.message += fmt.Sprintf("deleted: %s\n", MapHomeToTilde(e.To))
+	}
 	if err != nil {
-		return nil, func() tea.Msg {
-			return errMsg{err: err}
+		m.message += fmt.Sprintf("failed to delete: %v\n", err)
+	}
+
+	m.drop(gone)
+	m.refresh()
+	return m, nil
+}
+
+// drop removes the entries which are no longer in trash, keyed by the path in trash.
+func (m *model) drop(gone map[string]struct{}) {
+	kept := make(HistoryEntries, 0, len(m.entries))
+	for _, e := range m.entries {
+		if _, ok := gone[e.To]; !ok {
+			kept = append(kept, e)
 		}
 	}
+	m.entries = kept
+	if len(Versions(kept, m.versionsOf)) == 0 {
+		// no version is left
+		m.versionsOf = ""
+	}
+}
 
-	for _, f := range movedFiles {
-		m.message += fmt.Sprintf("restored: %s → %s\n", MapHomeToTilde(f.From), MapHomeToTilde(f.To))
+// answer resolves the first pending conflict, and restores once all of them are answered.
+func (m model) answer(key string) (tea.Model, tea.Cmd) {
+	var answer ConflictPolicy
+	switch key {
+	case "r":
+		answer = ConflictRename
+	case "o":
+		answer = ConflictOverwrite
+	case "s":
+		answer = ConflictSkip
+	case "esc", "ctrl+g":
+		// cancel restore
+		m.conflicts = nil
+		m.answers = nil
+		return m, nil
+	case "ctrl+c":
+		return m, tea.Quit
+	default:
+		return m, nil
+	}
+
+	m.answers[m.conflicts[0].Entry.To] = answer
+	m.conflicts = m.conflicts[1:]
+	if len(m.conflicts) > 0 {
+		return m, nil
+	}
+
+	return m.restore()
+}
+
+// entrySize is the size recorded when the entry was trashed, which older entries don't have.
+func entrySize(e HistoryEntry) string {
+	if e.Metadata == nil {
+		return "-"
+	}
+	return FormatSize(e.Metadata.Size)
+}
+
+// batchSize is the total size of the batch, unknown if any entry has no size recorded.
+func batchSize(b BatchEntries) string {
+	var total int64
+	for _, e := range b.Entries {
+		if e.Metadata == nil {
+			return "-"
+		}
+		total += e.Metadata.Size
+	}
+	return FormatSize(total)
+}
+
+// commonDir returns the deepest directory containing all the paths.
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for !hasPathPrefix(p, dir) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// previewOf returns the preview of the row, from the cache if the cursor has not moved.
+func (m model) previewOf(r row) string {
+	key := r.entry.To
+	if r.batch != nil {
+		key = "batch " + r.batch.ID + " " + r.batch.Removed().String()
+	}
+	if m.preview.key == key {
+		return m.preview.text
+	}
+
+	var text string
+	if r.batch != nil {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("batch of %d entries\n\n", len(r.batch.Entries)))
+		for _, e := range r.batch.Entries {
+			b.WriteString(filepath.Base(e.To) + "\n")
+		}
+		text = truncateLines(b.String(), MaxPreviewLines+2, "...\n")
+	} else {
+		preview, err := Preview(m.opts.FS, r.entry.To, MaxPreviewLines)
+		if err != nil {
+			preview = fmt.Sprintf("cannot preview: %v\n", err)
+		}
+		text = preview
+	}
+
+	m.preview.key = key
+	m.preview.text = text
+	return text
+}
+
+// filterView shows the chips and the search, or the filter when not searching.
+func (m model) filterView() string {
+	var b strings.Builder
+	for _, c := range m.filter.Chips {
+		b.WriteString(chipStyle.Render(c.Token) + " ")
+	}
+	if m.searching {
+		b.WriteString(m.search.View())
+	} else {
+		b.WriteString(fmt.Sprintf("/%s  (/ to edit, esc to clear)", m.filter.Pattern))
+	}
+	b.WriteString(fmt.Sprintf("  %d of %d entries\n", len(m.filter.Apply(m.entries)), len(m.entries)))
+	if m.filterErr != "" {
+		b.WriteString(m.filterErr + "\n")
+	}
+	return b.String()
+}
+
+// hiddenMarks counts the marked entries which the filter hides.
+func (m model) hiddenMarks() int {
+	return m.hidden(m.marked())
+}
+
+// hidden counts the entries which the filter hides.
+func (m model) hidden(entries HistoryEntries) int {
+	if m.filter.IsZero() || m.versionsOf != "" {
+		return 0
+	}
+	hidden := 0
+	for _, e := range entries {
+		if !m.filter.Match(e) {
+			hidden++
+		}
+	}
+	return hidden
+}
+
+// truncateLines keeps the first n lines of s, followed by more if any line is dropped.
+func truncateLines(s string, n int, more string) string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "") + more
+}
+
+// formatDetails describes the metadata of the entry under the cursor.
+func formatDetails(e HistoryEntry) string {
+	m := e.Metadata
+	if m == nil {
+		return "No details recorded for this entry\n"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Type: %v  Mode: %v  Owner: %v  Modified: %v\n",
+		m.Type, m.Mode, m.Owner(), m.ModTime.Format(RemovedAtFormat)))
+	b.WriteString(fmt.Sprintf("Trashed by `%v` in %v on %v (batch %v)\n",
+		m.CommandLine(), MapHomeToTilde(m.Cwd), m.Hostname, m.ID))
+	return b.String()
+}
+
+// formatBatchDetails describes the invocation of the batch under the cursor and its first entries.
+func formatBatchDetails(b BatchEntries) string {
+	var s strings.Builder
+	if batch, ok := b.Batch(); ok {
+		s.WriteString(fmt.Sprintf("Trashed by `%v` in %v on %v (batch %v)\n",
+			batch.CommandLine(), MapHomeToTilde(batch.Cwd), batch.Hostname, batch.ID))
+	} else {
+		s.WriteString("No details recorded for this batch\n")
 	}
+	for i, e := range b.Entries {
+		if i == MaxBatchDetails {
+			s.WriteString(fmt.Sprintf("  ... and %d more\n", len(b.Entries)-MaxBatchDetails))
+			break
+		}
+		s.WriteString(fmt.Sprintf("  %v ← %v\n", MapHomeToTilde(e.To), MapHomeToTilde(e.From)))
+	}
+	return s.String()
+}
 
-	return m, tea.Quit
+// formatPurging asks for the confirmation of permanent deletion, listing the first entries.
+// hidden is how many of them the filter hides, which must not be deleted unnoticed.
+func formatPurging(entries HistoryEntries, hidden int) string {
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("Permanently delete %d entries (%s)? This cannot be undone. [y/N]\n",
+		len(entries), batchSize(BatchEntries{Entries: entries})))
+	if hidden > 0 {
+		s.WriteString(fmt.Sprintf("  (%d of them hidden by the filter)\n", hidden))
+	}
+	for i, e := range entries {
+		if i == MaxBatchDetails {
+			s.WriteString(fmt.Sprintf("  ... and %d more\n", len(entries)-MaxBatchDetails))
+			break
+		}
+		s.WriteString(fmt.Sprintf("  %v (%v)\n", MapHomeToTilde(e.To), entrySize(e)))
+	}
+	s.WriteString("\n")
+	return s.String()
+}
+
+func formatRestoredFile(f RestoredFile) string {
+	line := fmt.Sprintf("restored: %s → %s", MapHomeToTilde(f.From), MapHomeToTilde(f.To))
+	if f.Renamed {
+		line += " (renamed, destination existed)"
+	}
+	if f.Overwritten != "" {
+		line += fmt.Sprintf(" (previous file trashed: %s)", MapHomeToTilde(f.Overwritten))
+	}
+	if f.Leftover != nil {
+		line += fmt.Sprintf(" (partly left in the trash: %v)", f.Leftover)
+	}
+	return line
 }
 
 func (m model) View() string {
@@ -202,30 +1011,91 @@ func (m model) View() string {
 
 	helpText := helpStyle.Render(`
 [Keys]
-  space / enter       : Toggle mark
+  space / enter       : Toggle mark (all the entries of a batch)
+  b                   : Group by batch / show each entry
+  v / esc             : Show the versions of the path / all the entries
+  d                   : Diff against the file at the original path
+  p                   : Show / hide the preview
+  /                   : Search (since:7d, until:2024-01-01 and in:~/dir are chips)
+  a                   : Mark / unmark all the rows shown
+  i                   : Invert the marks of the rows shown
+  V                   : Mark a range of rows, from here to the cursor
   X                   : Restore marked files
+  D                   : Delete marked files (or the one under the cursor) permanently
   q / Ctrl+C / Ctrl+G : Quit
 `)
 
 	b.WriteString(helpText + "\n")
-	b.WriteString(baseStyle.Render(m.table.View()) + "\n\n")
+	if m.opts.Dir != "" {
+		b.WriteString(fmt.Sprintf("Restore to: %v\n", MapHomeToTilde(m.opts.Dir)))
+	}
+	if m.versionsOf != "" {
+		b.WriteString(fmt.Sprintf("Versions of %v: %d, from the most recent\n", MapHomeToTilde(m.versionsOf), len(m.rows)))
+	} else if m.searching || !m.filter.IsZero() {
+		b.WriteString(m.filterView())
+	}
+	tableView := baseStyle.Render(m.table.View())
+	r, ok := m.current()
+	if m.showPreview && m.previewWidth > 0 && ok {
+		// fit the preview into the height of the table
+		height := lipgloss.Height(tableView) - 2
+		text := strings.TrimSuffix(truncateLines(m.previewOf(r), height, ""), "\n")
+		text = lipgloss.NewStyle().MaxWidth(m.previewWidth).Render(text)
+		pane := baseStyle.Width(m.previewWidth).Height(height).Render(text)
+		tableView = lipgloss.JoinHorizontal(lipgloss.Top, tableView, pane)
+	}
+	b.WriteString(tableView + "\n")
+	if ok {
+		if r.batch != nil {
+			b.WriteString(formatBatchDetails(*r.batch))
+		} else if r.entry.To == m.diffOf {
+			b.WriteString(m.diff)
+		} else {
+			b.WriteString(formatDetails(r.entry))
+			if n := m.versions[r.entry.From]; n > 1 && m.versionsOf == "" {
+				b.WriteString(fmt.Sprintf("%d versions of this path are in the trash (v to show)\n", n))
+			}
+		}
+	}
+	b.WriteString("\n")
 
-	if len(m.selected) == 0 {
-		return b.String()
+	if len(m.conflicts) > 0 {
+		b.WriteString(fmt.Sprintf("Already exists: %v\n", m.conflicts[0]))
+		b.WriteString("  r: rename / o: overwrite (trash the current file) / s: skip / esc: cancel\n\n")
 	}
 
-	selected := make(HistoryEntries, 0, len(m.selected))
-	for _, v := range m.selected {
-		selected = append(selected, v)
+	if len(m.purging) > 0 {
+		b.WriteString(formatPurging(m.purging, m.hidden(m.purging)))
 	}
-	selected = selected.Sorted()
 
-	b.WriteString("Selected files:\n")
+	if m.ranging {
+		b.WriteString("Marking a range: move the cursor, then V or enter to mark the rows / esc to cancel\n\n")
+	}
 
-	for i, f := range selected {
-		b.WriteString(
-			fmt.Sprintf("%v. %v → %v\n", i+1, MapHomeToTilde(f.To), MapHomeToTilde(f.From)),
-		)
+	if len(m.selected) > 0 {
+		b.WriteString("Selected files:\n")
+		if hidden := m.hiddenMarks(); hidden > 0 {
+			b.WriteString(fmt.Sprintf("(%d of them hidden by the filter)\n", hidden))
+		}
+
+		for i, f := range m.marked() {
+			b.WriteString(
+				fmt.Sprintf("%v. %v → %v\n", i+1, MapHomeToTilde(f.To), MapHomeToTilde(f.From)),
+			)
+			if err, ok := m.failed[f.To]; ok {
+				b.WriteString(fmt.Sprintf("   failed: %v\n", err))
+			}
+		}
+	}
+
+	if len(m.failed) > 0 || m.restoreErr != nil {
+		b.WriteString("\n")
+		if m.restoreErr != nil {
+			b.WriteString(fmt.Sprintf("Failed to restore: %v\n", m.restoreErr))
+		} else {
+			b.WriteString(fmt.Sprintf("Failed to restore %d entries (marked with !)\n", len(m.failed)))
+		}
+		b.WriteString("  r: retry / q: quit\n")
 	}
 
 	if m.message != "" {
@@ -236,16 +1106,117 @@ func (m model) View() string {
 	return b.String()
 }
 
-func Restore(historyEntries []HistoryEntry) error {
+// putBack restores the files trashed to make room for the entries which have failed to be restored,
+// so that they don't leave their place for nothing.
+func putBack(trash Trash, opts RestoreOptions, overwritten map[string]string, failed []*FileError) error {
+	var errs []error
+	for _, f := range failed {
+		trashed, ok := overwritten[f.To]
+		if !ok {
+			continue
+		}
+
+		entries, err := trash.Query(HistoryQuery{To: trashed})
+		if err == nil && len(entries) == 0 {
+			err = errors.Wrapf(ErrFileNotFound, "no entry of %v", trashed)
+		}
+		if err == nil {
+			_, err = RestoreEntries(trash, entries, RestoreOptions{Conflict: ConflictFail, FS: opts.FS})
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to put back the file which was at %v, it is kept in the trash at %v", f.To, trashed))
+			continue
+		}
+		log.Printf("put back: %v → %v", trashed, f.To)
+		delete(overwritten, f.To)
+	}
+	return errors.Join(errs...)
+}
+
+// RestoreEntries moves the entries back to where they came from, or into opts.Dir,
+// resolving conflicts with opts.Conflict, and records where they have been restored.
+func RestoreEntries(trash Trash, entries HistoryEntries, opts RestoreOptions) ([]RestoredFile, error) {
+	now := time.Now()
+	plan, err := planRestore(entries, opts, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// make room for the entries by trashing the current files
+	overwritten := make(map[string]string, len(plan.overwritten))
+	if len(plan.overwritten) > 0 {
+		trashed, err := trash.Put(plan.overwritten, opts.IsDryRun)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to trash the files to be overwritten")
+		}
+		for _, f := range trashed {
+			overwritten[f.From] = f.To
+		}
+	}
+
+	movedFiles, err := plan.files.moveEach(fsOrOS(opts.FS), opts.IsDryRun, now, nil)
+	if err != nil && len(overwritten) > 0 && !opts.IsDryRun {
+		if putBackErr := putBack(trash, opts, overwritten, FileErrors(err)); putBackErr != nil {
+			err = errors.Join(err, putBackErr)
+		}
+	}
+
+	restoredFiles := make([]RestoredFile, len(movedFiles))
+	for i, f := range movedFiles {
+		restoredFiles[i] = RestoredFile{
+			MovedFile:   f,
+			Renamed:     plan.renamed[f.From],
+			Overwritten: overwritten[f.To],
+		}
+	}
+
+	if opts.IsDryRun {
+		return restoredFiles, err
+	}
+
+	// record the files which have been restored, even if some of them failed
+	restored := make([]RestoredEntry, 0, len(movedFiles))
+	for _, f := range movedFiles {
+		restored = append(restored, NewRestoredEntry(plan.entries[f.From], f.To, f.MovedAt))
+	}
+	if recordErr := trash.RecordRestored(restored); recordErr != nil {
+		err = errors.Join(err, errors.Wrap(recordErr, "failed to record restored entries"))
+	}
+
+	return restoredFiles, err
+}
+
+func restoreDestination(entry HistoryEntry, opts RestoreOptions) string {
+	if opts.Dir == "" {
+		return entry.From
+	}
+	return filepath.Join(opts.Dir, filepath.Base(entry.From))
+}
+
+func Restore(trash Trash, historyEntries []HistoryEntry, opts RestoreOptions) error {
 	if len(historyEntries) == 0 {
 		fmt.Println("quit due to no history")
 		return nil
 	}
 
-	p := tea.NewProgram(newModel(historyEntries))
-	if _, err := p.Run(); err != nil {
+	p := tea.NewProgram(newModel(trash, historyEntries, opts))
+	final, err := p.Run()
+	if err != nil {
 		return err
 	}
 
+	// quit without restoring everything
+	if m, ok := final.(model); ok {
+		if m.restoreErr != nil {
+			return m.restoreErr
+		}
+		if len(m.failed) > 0 {
+			errs := make([]error, 0, len(m.failed))
+			for _, err := range m.failed {
+				errs = append(errs, err)
+			}
+			return errors.Wrapf(errors.Join(errs...), "failed to restore %d entries", len(m.failed))
+		}
+	}
 	return nil
 }
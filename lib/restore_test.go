@@ -0,0 +1,86 @@
+package lib_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: 復元ログの各行をパースして返す
+func readRestoreLog(t *testing.T, path string) []lib.RestoredEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var entries []lib.RestoredEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry lib.RestoredEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	assert.NoError(t, scanner.Err())
+	return entries
+}
+
+// 元の場所へ復元すると、途中のディレクトリも作り直され復元ログに記録される
+func TestRestoreEntries_Original(t *testing.T) {
+	trashDir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "dir", "file.txt")
+	createDummyFile(t, src)
+
+	trash := lib.NewHistoryTrash(trashDir)
+	_, err := trash.Put([]string{src}, false)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(filepath.Dir(src)))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	assert.FileExists(t, src)
+
+	log := readRestoreLog(t, filepath.Join(trashDir, lib.RestoreLogFileName))
+	assert.Len(t, log, 1)
+	assert.Equal(t, src, log[0].From)
+	assert.Equal(t, src, log[0].RestoredTo)
+}
+
+// 別のディレクトリへ復元でき、その場所が復元ログに記録される
+func TestRestoreEntries_AlternateDir(t *testing.T) {
+	trashDir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "file.txt")
+	createDummyFile(t, src)
+
+	trash := lib.NewHistoryTrash(trashDir)
+	_, err := trash.Put([]string{src}, false)
+	assert.NoError(t, err)
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+
+	dir := filepath.Join(t.TempDir(), "not", "exist")
+	restored, err := lib.RestoreEntries(trash, entries, lib.RestoreOptions{Dir: dir})
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	assert.FileExists(t, filepath.Join(dir, "file.txt"))
+	assert.NoFileExists(t, src)
+
+	log := readRestoreLog(t, filepath.Join(trashDir, lib.RestoreLogFileName))
+	assert.Len(t, log, 1)
+	assert.Equal(t, filepath.Join(dir, "file.txt"), log[0].RestoredTo)
+
+	// 復元したエントリは履歴から消える
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
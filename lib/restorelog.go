@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const RestoreLogFileName = "go-to-trash-restored.json"
+
+// RestoredEntry records where an entry has been restored, since it may differ from where it came from.
+type RestoredEntry struct {
+	HistoryEntry
+	RestoredTo string    `json:"restored_to"`
+	Restored   RemovedAt `json:"restored_at"`
+}
+
+func NewRestoredEntry(entry HistoryEntry, restoredTo string, restored time.Time) RestoredEntry {
+	return RestoredEntry{
+		HistoryEntry: entry,
+		RestoredTo:   restoredTo,
+		Restored:     RemovedAt(restored),
+	}
+}
+
+// appendRestoreLog appends entries to the restore log in dir.
+func appendRestoreLog(dir string, entries []RestoredEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return errors.Wrap(err, "mkdirall")
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, RestoreLogFileName), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open restore log")
+	}
+	defer f.Close()
+
+	if err := terminateLastLine(f); err != nil {
+		return err
+	}
+	if err := writeJSONLines(f, entries); err != nil {
+		return errors.Wrap(err, "failed to write restore log")
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,253 @@
+package lib_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/teatest"
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper: キーを順に送る
+func sendKeys(m tea.Model, keys ...tea.KeyMsg) tea.Model {
+	for _, k := range keys {
+		m, _ = m.Update(k)
+	}
+	return m
+}
+
+func runes(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+var (
+	keyDown  = tea.KeyMsg{Type: tea.KeyDown}
+	keyEnter = tea.KeyMsg{Type: tea.KeyEnter}
+	keyEsc   = tea.KeyMsg{Type: tea.KeyEsc}
+)
+
+// helper: メモリ上のゴミ箱に names を入れたモデル。行は入れた順に並ぶ
+func newMemModel(t *testing.T, opts lib.RestoreOptions, names ...string) (tea.Model, *lib.HistoryTrash, *lib.MemFileSystem) {
+	t.Helper()
+	trash, fsys, _ := newMemTrash(t)
+	srcDir := memSrcDir(t, fsys)
+	for _, name := range names {
+		path := filepath.Join(srcDir, name)
+		writeMemFile(t, fsys, path, name)
+		_, err := trash.Put([]string{path}, false)
+		assert.NoError(t, err)
+	}
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	opts.FS = fsys
+	return lib.NewModel(trash, entries, opts), trash, fsys
+}
+
+func markedNames(m tea.Model) []string {
+	names := make([]string, 0)
+	for _, e := range lib.Marked(m) {
+		names = append(names, filepath.Base(e.From))
+	}
+	return names
+}
+
+func TestRestoreUI_MarkAllAndInvert(t *testing.T) {
+	m, _, _ := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt", "c.txt")
+
+	m = sendKeys(m, runes("a"))
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt", "c.txt"}, markedNames(m))
+	// 全部付いていれば外す
+	m = sendKeys(m, runes("a"))
+	assert.Empty(t, markedNames(m))
+
+	m = sendKeys(m, runes(" "), runes("i"))
+	assert.ElementsMatch(t, []string{"b.txt", "c.txt"}, markedNames(m))
+}
+
+// 絞り込み中は見えている行だけが対象で、隠れた印は残る
+func TestRestoreUI_MarkAllWithFilter(t *testing.T) {
+	m, _, _ := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt", "c.go")
+
+	m = sendKeys(m, runes(" "), runes("/"), runes("t"), runes("x"), runes("t"), keyEnter, runes("a"))
+	// c.go は隠れている
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt"}, markedNames(m))
+
+	m = sendKeys(m, runes("i"))
+	assert.Empty(t, markedNames(m))
+
+	m = sendKeys(m, keyEsc, runes("i"))
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt", "c.go"}, markedNames(m))
+}
+
+func TestRestoreUI_MarkRange(t *testing.T) {
+	m, _, _ := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt", "c.txt", "d.txt")
+
+	m = sendKeys(m, keyDown, runes("V"), keyDown, keyDown)
+	assert.Contains(t, m.View(), "Marking a range")
+	m = sendKeys(m, runes("V"))
+	assert.ElementsMatch(t, []string{"b.txt", "c.txt", "d.txt"}, markedNames(m))
+	assert.NotContains(t, m.View(), "Marking a range")
+
+	// 上向きにも選べて、esc で取り消せる
+	m = sendKeys(m, runes("a"), runes("a"), runes("V"), tea.KeyMsg{Type: tea.KeyUp}, keyEsc, runes("V"), tea.KeyMsg{Type: tea.KeyUp}, keyEnter)
+	assert.ElementsMatch(t, []string{"b.txt", "c.txt"}, markedNames(m))
+}
+
+// 印が無ければカーソルの行を消す。確認で y 以外なら消さない
+func TestRestoreUI_DeleteUnderCursor(t *testing.T) {
+	m, trash, fsys := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt")
+
+	m = sendKeys(m, keyDown, runes("D"))
+	assert.Contains(t, m.View(), "Permanently delete 1 entries (5B)?")
+	m = sendKeys(m, runes("n"))
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	m = sendKeys(m, runes("D"), runes("y"))
+	assert.Contains(t, m.View(), "deleted: ")
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "a.txt", filepath.Base(entries[0].From))
+	_, err = fsys.Lstat(filepath.Join(trash.Dir, "b.txt"))
+	assert.Error(t, err)
+}
+
+// 絞り込みで隠れた印も消すので、確認にその数を出す
+func TestRestoreUI_DeleteHiddenMarks(t *testing.T) {
+	m, trash, _ := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt", "c.go")
+
+	m = sendKeys(m, runes("a"), runes("/"), runes("g"), runes("o"), keyEnter, runes("D"))
+	view := m.View()
+	assert.Contains(t, view, "Permanently delete 3 entries")
+	assert.Contains(t, view, "(2 of them hidden by the filter)")
+
+	m = sendKeys(m, runes("y"))
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// helper: 画面に want が出るまで待つ
+func waitFor(t *testing.T, tm *teatest.TestModel, want string) {
+	t.Helper()
+	teatest.WaitFor(t, tm.Output(), func(out []byte) bool {
+		return bytes.Contains(out, []byte(want))
+	}, teatest.WithDuration(3*time.Second))
+}
+
+func startUI(t *testing.T, m tea.Model) *teatest.TestModel {
+	t.Helper()
+	return teatest.NewTestModel(t, m, teatest.WithInitialTermSize(200, 60))
+}
+
+// 何も選ばずに復元しても落ちずに続ける
+func TestRestoreUI_RestoreNothingMarked(t *testing.T) {
+	m, trash, _ := newMemModel(t, lib.RestoreOptions{}, "a.txt")
+	tm := startUI(t, m)
+
+	tm.Send(runes("X"))
+	waitFor(t, tm, "Nothing is marked")
+
+	tm.Send(runes("q"))
+	tm.WaitFinished(t, teatest.WithFinalTimeout(3*time.Second))
+	assert.NotNil(t, tm.FinalModel(t))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// 一部だけ失敗したら、戻せたものと失敗の理由を見せて続け、やり直せる
+func TestRestoreUI_PartialFailureAndRetry(t *testing.T) {
+	m, trash, fsys := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt")
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	failing := entries[0]
+	fsys.Fail("rename", failing.To, syscall.EACCES)
+
+	tm := startUI(t, m)
+	tm.Send(runes("a"))
+	tm.Send(runes("X"))
+	waitFor(t, tm, "r: retry / q: quit")
+
+	// b.txt だけ戻っている
+	left, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{failing.To}, []string{left[0].To})
+	_, err = fsys.Lstat(entries[1].From)
+	assert.NoError(t, err)
+
+	fsys.Fail("rename", failing.To, nil)
+	tm.Send(runes("r"))
+	tm.WaitFinished(t, teatest.WithFinalTimeout(3*time.Second))
+
+	final := tm.FinalModel(t)
+	assert.Empty(t, lib.Marked(final))
+	assert.Contains(t, final.View(), "restored: "+lib.MapHomeToTilde(failing.To))
+	assert.NotContains(t, final.View(), "r: retry")
+	left, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, left)
+	_, err = fsys.Lstat(failing.From)
+	assert.NoError(t, err)
+}
+
+func TestRestoreUI_PartialFailureView(t *testing.T) {
+	m, trash, fsys := newMemModel(t, lib.RestoreOptions{}, "a.txt", "b.txt")
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	fsys.Fail("rename", entries[0].To, syscall.EACCES)
+
+	m = sendKeys(m, runes("a"), runes("X"))
+	view := m.View()
+	assert.Contains(t, view, "restored: "+lib.MapHomeToTilde(entries[1].To))
+	assert.Contains(t, view, "failed: move file: ")
+	assert.Contains(t, view, "permission denied")
+	assert.Contains(t, view, "Failed to restore 1 entries (marked with !)")
+	// 失敗したものは印が付いたまま
+	assert.Equal(t, []string{entries[0].To}, []string{lib.Marked(m)[0].To})
+}
+
+// ファイル以外の失敗も、終わらずに見せる
+func TestRestoreUI_ConflictFailure(t *testing.T) {
+	m, trash, fsys := newMemModel(t, lib.RestoreOptions{Conflict: lib.ConflictFail}, "a.txt")
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	writeMemFile(t, fsys, entries[0].From, "new")
+
+	tm := startUI(t, m)
+	tm.Send(runes(" "))
+	tm.Send(runes("X"))
+	waitFor(t, tm, "Failed to restore: ")
+
+	tm.Send(runes("q"))
+	tm.WaitFinished(t, teatest.WithFinalTimeout(3*time.Second))
+	assert.Contains(t, tm.FinalModel(t).View(), lib.ErrRestoreConflict.Error())
+
+	left, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, left, 1)
+	data, err := fsys.ReadFile(entries[0].From)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+// 差分はモデルのファイルシステムで比べる
+func TestRestoreUI_DiffWithMemFS(t *testing.T) {
+	m, trash, fsys := newMemModel(t, lib.RestoreOptions{}, "a.txt")
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	writeMemFile(t, fsys, entries[0].From, "current\n")
+
+	m = sendKeys(m, runes("d"))
+	view := m.View()
+	assert.Contains(t, view, "-current")
+	assert.Contains(t, view, "+a.txt")
+}
@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrInvalidSize = errors.New("invalid size")
+	ErrInvalidAge  = errors.New("invalid age")
+)
+
+var sizeUnits = []string{"B", "K", "M", "G", "T", "P"}
+
+// DiskUsage returns the total size of the files under path, or of path itself if it's not a directory.
+// Symlinks are not followed.
+func DiskUsage(path string) (int64, error) {
+	return diskUsage(OSFileSystem{}, path)
+}
+
+// diskUsage is DiskUsage on fsys.
+func diskUsage(fsys FileSystem, path string) (int64, error) {
+	fi, err := fsys.Lstat(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "walk")
+	}
+	if !fi.IsDir() {
+		return fi.Size(), nil
+	}
+
+	children, err := readDir(fsys, path)
+	if err != nil {
+		return 0, errors.Wrap(err, "walk")
+	}
+	var total int64
+	for _, c := range children {
+		size, err := diskUsage(fsys, filepath.Join(path, c.Name()))
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// ParseSize parses sizes such as `1024`, `10K`, `1.5G` or `2MB` (powers of 1024).
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "IB")
+	if len(str) > 1 && strings.HasSuffix(str, "B") {
+		str = strings.TrimSuffix(str, "B")
+	}
+
+	multiplier := int64(1)
+	for i, unit := range sizeUnits {
+		if i > 0 && strings.HasSuffix(str, unit) {
+			str = strings.TrimSuffix(str, unit)
+			multiplier = int64(1) << (10 * i)
+			break
+		}
+	}
+
+	// ParseFloat also accepts NaN and Inf, and the size must fit in int64
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(n) || n < 0 {
+		return 0, errors.Wrapf(ErrInvalidSize, "%q", s)
+	}
+	size := n * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, errors.Wrapf(ErrInvalidSize, "%q is too large", s)
+	}
+	return int64(size), nil
+}
+
+// FormatSize formats size in a human readable form such as `1.5G`.
+func FormatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	n := float64(size)
+	i := 0
+	for n >= 1024 && i < len(sizeUnits)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", n, sizeUnits[i])
+}
+
+// ParseAge parses durations such as `30d`, `2w` in addition to the ones time.ParseDuration accepts.
+func ParseAge(s string) (time.Duration, error) {
+	str := strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(str, suffix); ok {
+			// like ParseSize, NaN, Inf and ages which don't fit in time.Duration are invalid
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil || math.IsNaN(f) || f < 0 {
+				return 0, errors.Wrapf(ErrInvalidAge, "%q", s)
+			}
+			age := f * float64(unit)
+			if age >= math.MaxInt64 {
+				return 0, errors.Wrapf(ErrInvalidAge, "%q is too long", s)
+			}
+			return time.Duration(age), nil
+		}
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		return 0, errors.Wrapf(ErrInvalidAge, "%q", s)
+	}
+	return d, nil
+}
+
+// removeAll removes path like os.RemoveAll, making read-only directories writable if needed.
+func removeAll(path string) error {
+	if err := os.RemoveAll(path); err == nil {
+		return nil
+	}
+
+	_ = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			_ = os.Chmod(p, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// HistoryStoreJSONL keeps the history in a JSON lines file, which is read as a whole.
+	HistoryStoreJSONL = "jsonl"
+	// HistoryStoreBolt keeps the history in an indexed bbolt database, for large trashes.
+	HistoryStoreBolt = "bolt"
+
+	// ImportedExt is appended to the JSONL history once it's imported into another store.
+	ImportedExt = ".imported"
+)
+
+var (
+	ErrUnknownHistoryStore = errors.New("unknown history store")
+)
+
+// HistoryStore keeps the entries of a trash dir. The caller must hold the lock of the trash dir.
+type HistoryStore interface {
+	// Load returns all the entries.
+	Load() (HistoryEntries, error)
+	// Append records the entries, replacing the ones with the same path in trash.
+	Append(entries []HistoryEntry) error
+	// Remove drops the entries, matched by their path in trash.
+	Remove(entries []HistoryEntry) error
+	// Query returns the entries which match q.
+	Query(q HistoryQuery) (HistoryEntries, error)
+	// Compact drops duplicated entries and reclaims the space left by removed ones.
+	Compact() error
+	Close() error
+}
+
+// HistoryQuery selects entries. Zero values don't filter.
+type HistoryQuery struct {
+	// To is the exact path in trash.
+	To string
+	// From is the exact original path.
+	From string
+	// FromPrefix selects the entries whose original path is FromPrefix or under it.
+	FromPrefix string
+	// Since and Until select the entries removed in [Since, Until).
+	Since time.Time
+	Until time.Time
+}
+
+func (q HistoryQuery) Match(e HistoryEntry) bool {
+	if q.To != "" && e.To != q.To {
+		return false
+	}
+	if q.From != "" && e.From != q.From {
+		return false
+	}
+	if q.FromPrefix != "" && !hasPathPrefix(e.From, q.FromPrefix) {
+		return false
+	}
+	removed := e.Removed.Time()
+	if !q.Since.IsZero() && removed.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !removed.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// OpenHistoryStore opens the store of kind in trashDir.
+func OpenHistoryStore(kind, trashDir string, timeout time.Duration) (HistoryStore, error) {
+	switch kind {
+	case "", HistoryStoreJSONL:
+		return OpenJSONLHistoryStore(trashDir)
+	case HistoryStoreBolt:
+		return OpenBoltHistoryStore(filepath.Join(trashDir, BoltHistoryFileName), timeout)
+	default:
+		return nil, errors.Wrapf(ErrUnknownHistoryStore, "%q (jsonl or bolt)", kind)
+	}
+}
+
+// ValidateHistoryStore checks that kind is a known store.
+func ValidateHistoryStore(kind string) error {
+	switch kind {
+	case "", HistoryStoreJSONL, HistoryStoreBolt:
+		return nil
+	default:
+		return errors.Wrapf(ErrUnknownHistoryStore, "%q (jsonl or bolt)", kind)
+	}
+}
+
+// query returns the entries of store which match q, and drops the ones whose file has left the trash.
+func query(fsys FileSystem, store HistoryStore, q HistoryQuery) (HistoryEntries, error) {
+	entries, err := store.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(HistoryEntries, 0, len(entries))
+	missing := make(HistoryEntries, 0)
+	for _, e := range UniqByKey(entries, func(e HistoryEntry) string { return e.To }) {
+		if _, err := fsOrOS(fsys).Lstat(e.To); err != nil {
+			if os.IsNotExist(err) {
+				missing = append(missing, e)
+				continue
+			}
+			return nil, errors.Wrap(err, "failed to check file existence")
+		}
+		existing = append(existing, e)
+	}
+
+	if err := store.Remove(missing); err != nil {
+		return nil, errors.Wrap(err, "failed to drop missing entries")
+	}
+	return existing, nil
+}
+
+// ImportJSONLHistory copies the entries of the JSONL history in trashDir into store,
+// and keeps the JSONL history with the ImportedExt suffix so that it's not used any more.
+func ImportJSONLHistory(trashDir string, store HistoryStore) (int, error) {
+	history, err := LoadHistory(trashDir)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(history.Path); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	entries := UniqByKey(history.Entries, func(e HistoryEntry) string { return e.To })
+	if err := store.Append(entries); err != nil {
+		return 0, errors.Wrap(err, "append")
+	}
+	if err := os.Rename(history.Path, history.Path+ImportedExt); err != nil {
+		return 0, errors.Wrap(err, "rename imported history")
+	}
+	if len(history.Unparsed) > 0 {
+		log.Printf("%d lines of %v could not be imported, they are kept in %v", len(history.Unparsed), history.Path, history.Path+ImportedExt)
+	}
+	// the backup would be loaded in place of the history
+	if err := os.Remove(backupPath(history.Path)); err != nil && !os.IsNotExist(err) {
+		return 0, errors.Wrap(err, "remove backup of imported history")
+	}
+	return len(entries), nil
+}
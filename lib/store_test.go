@@ -0,0 +1,289 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func openBoltStore(t *testing.T, dir string) *lib.BoltHistoryStore {
+	t.Helper()
+	store, err := lib.OpenBoltHistoryStore(filepath.Join(dir, lib.BoltHistoryFileName), time.Second)
+	assert.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func storeFixture() []lib.HistoryEntry {
+	at := func(day int) lib.RemovedAt {
+		return lib.RemovedAt(time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC))
+	}
+	return []lib.HistoryEntry{
+		{From: "/home/user/a.txt", To: "/trash/a.txt", Removed: at(1)},
+		{From: "/home/user/project/b.txt", To: "/trash/b.txt", Removed: at(2)},
+		{From: "/home/user/a.txt", To: "/trash/a.txt_2024", Removed: at(3)},
+		{From: "/home/user/project2/c.txt", To: "/trash/c.txt", Removed: at(4)},
+	}
+}
+
+func queryTos(t *testing.T, store lib.HistoryStore, q lib.HistoryQuery) []string {
+	t.Helper()
+	entries, err := store.Query(q)
+	assert.NoError(t, err)
+	tos := make([]string, 0, len(entries))
+	for _, e := range entries.Sorted() {
+		tos = append(tos, e.To)
+	}
+	return tos
+}
+
+// インデックスを使った検索が全件走査と同じ結果になる
+func TestBoltHistoryStore_Query(t *testing.T) {
+	store := openBoltStore(t, t.TempDir())
+	assert.NoError(t, store.Append(storeFixture()))
+
+	entries, err := store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	assert.Equal(t, []string{"/trash/b.txt"}, queryTos(t, store, lib.HistoryQuery{To: "/trash/b.txt"}))
+	assert.Equal(t, []string{"/trash/a.txt", "/trash/a.txt_2024"}, queryTos(t, store, lib.HistoryQuery{From: "/home/user/a.txt"}))
+
+	// project2 は project の下ではない
+	assert.Equal(t, []string{"/trash/b.txt"}, queryTos(t, store, lib.HistoryQuery{FromPrefix: "/home/user/project"}))
+
+	assert.Equal(t, []string{"/trash/b.txt", "/trash/a.txt_2024"}, queryTos(t, store, lib.HistoryQuery{
+		Since: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}))
+
+	// 複数の条件は全て満たすものだけ
+	assert.Equal(t, []string{"/trash/a.txt_2024"}, queryTos(t, store, lib.HistoryQuery{
+		From:  "/home/user/a.txt",
+		Since: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}))
+}
+
+// 同じ To のエントリは置き換えられ、古いインデックスが残らない
+func TestBoltHistoryStore_AppendReplaces(t *testing.T) {
+	store := openBoltStore(t, t.TempDir())
+	assert.NoError(t, store.Append(storeFixture()))
+
+	replaced := lib.HistoryEntry{
+		From:    "/home/user/other.txt",
+		To:      "/trash/a.txt",
+		Removed: lib.RemovedAt(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	assert.NoError(t, store.Append([]lib.HistoryEntry{replaced}))
+
+	entries, err := store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	assert.Equal(t, []string{"/trash/a.txt_2024"}, queryTos(t, store, lib.HistoryQuery{From: "/home/user/a.txt"}))
+	assert.Equal(t, []string{"/trash/a.txt"}, queryTos(t, store, lib.HistoryQuery{From: "/home/user/other.txt"}))
+	assert.Empty(t, queryTos(t, store, lib.HistoryQuery{Until: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}))
+}
+
+func TestBoltHistoryStore_Remove(t *testing.T) {
+	dir := t.TempDir()
+	store := openBoltStore(t, dir)
+	fixture := storeFixture()
+	assert.NoError(t, store.Append(fixture))
+	assert.NoError(t, store.Remove(fixture[:2]))
+
+	assert.Equal(t, []string{"/trash/a.txt_2024", "/trash/c.txt"}, queryTos(t, store, lib.HistoryQuery{}))
+	assert.Empty(t, queryTos(t, store, lib.HistoryQuery{FromPrefix: "/home/user/project"}))
+
+	// 開き直しても残っている
+	assert.NoError(t, store.Close())
+	reopened := openBoltStore(t, dir)
+	assert.Equal(t, []string{"/trash/a.txt_2024", "/trash/c.txt"}, queryTos(t, reopened, lib.HistoryQuery{}))
+}
+
+// JSONL の履歴を取り込んだら、元のファイルは使われないように名前が変わる
+func TestImportJSONLHistory(t *testing.T) {
+	trashDir := t.TempDir()
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.NoError(t, history.AppendHistory(storeFixture()))
+
+	store := openBoltStore(t, trashDir)
+	n, err := lib.ImportJSONLHistory(trashDir, store)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []string{"/trash/a.txt", "/trash/b.txt", "/trash/a.txt_2024", "/trash/c.txt"}, queryTos(t, store, lib.HistoryQuery{}))
+
+	historyPath := filepath.Join(trashDir, lib.HistoryFileName)
+	assert.NoFileExists(t, historyPath)
+	assert.FileExists(t, historyPath+lib.ImportedExt)
+
+	// 2回目は何もしない
+	n, err = lib.ImportJSONLHistory(trashDir, store)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+// bolt を使うゴミ箱でも移動・固定・削除ができ、既存の JSONL は初回に取り込まれる
+func TestHistoryTrash_BoltStore(t *testing.T) {
+	trashDir := t.TempDir()
+	putFiles(t, lib.NewHistoryTrash(trashDir), "a.txt")
+
+	trash := lib.NewHistoryTrash(trashDir)
+	trash.Store = lib.HistoryStoreBolt
+	putFiles(t, trash, "b.txt", "c.txt")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt"}, baseNames(entries.Sorted()))
+	assert.FileExists(t, filepath.Join(trashDir, lib.BoltHistoryFileName))
+	assert.FileExists(t, filepath.Join(trashDir, lib.HistoryFileName+lib.ImportedExt))
+
+	sorted := entries.Sorted()
+	assert.NoError(t, trash.Pin(sorted[:1], true))
+	purged, err := trash.Purge(sorted[1:2])
+	assert.NoError(t, err)
+	assert.Len(t, purged, 1)
+	assert.NoFileExists(t, sorted[1].To)
+
+	entries, err = trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "c.txt"}, baseNames(entries.Sorted()))
+	assert.True(t, entries.Sorted()[0].Pinned)
+
+	// ゴミ箱から消えたファイルのエントリは検索時に落とされる
+	assert.NoError(t, os.Remove(sorted[2].To))
+	entries, err = trash.Query(lib.HistoryQuery{From: sorted[2].From})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// 中断されたバッチは bolt にも復旧される
+func TestHistoryTrash_BoltStoreRecover(t *testing.T) {
+	trashDir := t.TempDir()
+	entry := lib.HistoryEntry{
+		From:    filepath.Join(t.TempDir(), "moved.txt"),
+		To:      filepath.Join(trashDir, "moved.txt"),
+		Removed: lib.RemovedAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	createDummyFile(t, entry.To)
+	assert.NoError(t, lib.NewJournal(trashDir).Begin([]lib.HistoryEntry{entry}))
+
+	trash := lib.NewHistoryTrash(trashDir)
+	trash.Store = lib.HistoryStoreBolt
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entry.From, entries[0].From)
+	assert.NoFileExists(t, filepath.Join(trashDir, lib.JournalFileName))
+}
+
+// 同じ To のエントリは1つにまとめられる
+func TestHistoryStore_Compact(t *testing.T) {
+	duplicated := append(storeFixture(), lib.HistoryEntry{
+		From:    "/home/user/a.txt",
+		To:      "/trash/a.txt",
+		Removed: lib.RemovedAt(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)),
+	})
+
+	trashDir := t.TempDir()
+	history, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.NoError(t, history.AppendHistory(duplicated))
+
+	for name, store := range map[string]lib.HistoryStore{
+		"jsonl":  history,
+		"memory": lib.NewMemoryHistoryStore(duplicated...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Compact())
+			entries, err := store.Load()
+			assert.NoError(t, err)
+			assert.Len(t, entries, 4)
+		})
+	}
+
+	// 書き直された履歴にも重複は残らない
+	reloaded, err := lib.LoadHistory(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, reloaded.Entries, 4)
+}
+
+// 削除後に詰め直しても中身は変わらず、ファイルは小さくなる
+func TestBoltHistoryStore_Compact(t *testing.T) {
+	dir := t.TempDir()
+	store := openBoltStore(t, dir)
+
+	entries := make([]lib.HistoryEntry, 0, 1000)
+	for i := range 1000 {
+		entries = append(entries, lib.HistoryEntry{
+			From:    filepath.Join("/home/user", strings.Repeat("x", 100), strconv.Itoa(i)),
+			To:      filepath.Join("/trash", strconv.Itoa(i)),
+			Removed: lib.RemovedAt(time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC)),
+		})
+	}
+	assert.NoError(t, store.Append(entries))
+	assert.NoError(t, store.Remove(entries[1:]))
+
+	before, err := os.Stat(store.Path())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Compact())
+	after, err := os.Stat(store.Path())
+	assert.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	assert.Equal(t, []string{"/trash/0"}, queryTos(t, store, lib.HistoryQuery{}))
+	assert.Equal(t, []string{"/trash/0"}, queryTos(t, store, lib.HistoryQuery{FromPrefix: "/home/user"}))
+	assert.NoError(t, store.Append(entries[1:2]))
+	assert.Len(t, queryTos(t, store, lib.HistoryQuery{}), 2)
+}
+
+// OpenStore を差し替えれば履歴をディスクに書かずに使える
+func TestHistoryTrash_MemoryStore(t *testing.T) {
+	trashDir := t.TempDir()
+	store := lib.NewMemoryHistoryStore()
+	trash := lib.NewHistoryTrash(trashDir)
+	trash.OpenStore = func(dir string) (lib.HistoryStore, error) {
+		return store, nil
+	}
+
+	putFiles(t, trash, "a.txt", "b.txt")
+	assert.NoFileExists(t, filepath.Join(trashDir, lib.HistoryFileName))
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, baseNames(entries.Sorted()))
+
+	purged, err := trash.Purge(entries.Sorted()[:1])
+	assert.NoError(t, err)
+	assert.Len(t, purged, 1)
+
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b.txt"}, baseNames(loaded))
+}
+
+// bolt の場合は migrate で JSONL の取り込みと詰め直しをする
+func TestHistoryTrash_MigrateBolt(t *testing.T) {
+	trashDir := t.TempDir()
+	putFiles(t, lib.NewHistoryTrash(trashDir), "a.txt")
+
+	trash := lib.NewHistoryTrash(trashDir)
+	trash.Store = lib.HistoryStoreBolt
+	migrations, err := trash.Migrate(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []lib.Migration{
+		{Path: filepath.Join(trashDir, lib.HistoryFileName), From: lib.HistoryFormatVersion, To: lib.HistoryFormatVersion, Imported: 1},
+		{Path: filepath.Join(trashDir, lib.BoltHistoryFileName), From: lib.BoltHistoryVersion, To: lib.BoltHistoryVersion, Compacted: true},
+	}, migrations)
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
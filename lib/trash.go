@@ -0,0 +1,513 @@
+package lib
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// BackendHistory keeps removed files flat in the trash dir and records them in the history file.
+	BackendHistory = "gototrash"
+	// BackendFreedesktop follows the FreeDesktop.org Trash specification (files/ + info/).
+	BackendFreedesktop = "freedesktop"
+)
+
+var (
+	ErrUnknownBackend = errors.New("unknown backend")
+)
+
+// Trash is a storage backend that keeps removed files and remembers where they came from.
+type Trash interface {
+	// Put moves the given paths into the trash and records them.
+	Put(paths []string, isDryRun bool) ([]MovedFile, error)
+	// Entries returns the entries which can be restored.
+	Entries() (HistoryEntries, error)
+	// Query returns the entries which can be restored and match q.
+	Query(q HistoryQuery) (HistoryEntries, error)
+	// RecordRestored records where the entries have been restored.
+	RecordRestored(entries []RestoredEntry) error
+	// Purge removes the entries permanently and returns the ones which have been removed.
+	Purge(entries HistoryEntries) (HistoryEntries, error)
+	// Pin protects the entries from eviction by the quota, or unpins them.
+	Pin(entries HistoryEntries, pinned bool) error
+	// Migrate rewrites the histories in older formats in the current format.
+	Migrate(isDryRun bool) ([]Migration, error)
+}
+
+// TrashOptions are the settings which only some backends support.
+type TrashOptions struct {
+	Quota Quota
+	// HistoryStore is the kind of store of the history.
+	HistoryStore string
+}
+
+func NewTrash(backend, trashDir string, opts TrashOptions) (Trash, error) {
+	if err := ValidateHistoryStore(opts.HistoryStore); err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case "", BackendHistory:
+		trash := NewHistoryTrash(trashDir)
+		trash.Quota = opts.Quota
+		trash.Store = opts.HistoryStore
+		return trash, nil
+	case BackendFreedesktop:
+		if !opts.Quota.IsZero() {
+			log.Printf("quota is not supported by the %v backend, ignored", BackendFreedesktop)
+		}
+		if opts.HistoryStore != "" {
+			log.Printf("historyStore is not supported by the %v backend, ignored", BackendFreedesktop)
+		}
+		return NewFreedesktopTrash(trashDir), nil
+	default:
+		return nil, errors.Wrapf(ErrUnknownBackend, "backend: %v", backend)
+	}
+}
+
+var _ Trash = (*HistoryTrash)(nil)
+
+// HistoryTrash is the original gototrash backend.
+type HistoryTrash struct {
+	Dir string
+	// LockTimeout is how long to wait for other processes using the same history.
+	LockTimeout time.Duration
+	// Quota is enforced on each trash dir after files are moved into it.
+	Quota Quota
+	// Store is the kind of store of the histories, HistoryStoreJSONL by default.
+	Store string
+	// OpenStore opens the store of each trash dir in place of Store if set, e.g. a MemoryHistoryStore in tests.
+	OpenStore func(dir string) (HistoryStore, error)
+	// FS is where the files are moved, the OS file system if nil. The lock, journal and history stay on disk.
+	FS FileSystem
+
+	mu sync.Mutex
+	// volumes is the trash dirs of the other volumes found by roots, nil until looked up.
+	volumes []string
+}
+
+func NewHistoryTrash(dir string) *HistoryTrash {
+	return &HistoryTrash{
+		Dir:         dir,
+		LockTimeout: DefaultLockTimeout,
+	}
+}
+
+func (t *HistoryTrash) Entries() (HistoryEntries, error) {
+	return t.Query(HistoryQuery{})
+}
+
+func (t *HistoryTrash) Query(q HistoryQuery) (HistoryEntries, error) {
+	entries := make(HistoryEntries, 0)
+	for _, dir := range t.roots() {
+		// nothing has been trashed yet
+		if !isUsableDir(dir) {
+			continue
+		}
+
+		err := t.withStore(dir, func(store HistoryStore) error {
+			found, err := query(t.FS, store, q)
+			entries = append(entries, found...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (t *HistoryTrash) RecordRestored(entries []RestoredEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return t.withLock(t.Dir, func() error {
+		return appendRestoreLog(t.Dir, entries)
+	})
+}
+
+func (t *HistoryTrash) Purge(entries HistoryEntries) (HistoryEntries, error) {
+	purged := make(HistoryEntries, 0, len(entries))
+	err := t.eachRoot(entries, func(store HistoryStore, found HistoryEntries) error {
+		removed := make(HistoryEntries, 0, len(found))
+		var errs []error
+		for _, e := range found {
+			if err := fsOrOS(t.FS).RemoveAll(e.To); err != nil {
+				errs = append(errs, errors.Wrapf(err, "remove %v", e.To))
+				continue
+			}
+			removed = append(removed, e)
+		}
+
+		if err := store.Remove(removed); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to update history"))
+		}
+		purged = append(purged, removed...)
+		return errors.Join(errs...)
+	})
+
+	return purged, err
+}
+
+func (t *HistoryTrash) Pin(entries HistoryEntries, pinned bool) error {
+	return t.eachRoot(entries, func(store HistoryStore, found HistoryEntries) error {
+		for i := range found {
+			found[i].Pinned = pinned
+		}
+		return store.Append(found)
+	})
+}
+
+func (t *HistoryTrash) Migrate(isDryRun bool) ([]Migration, error) {
+	migrations := make([]Migration, 0)
+	for _, dir := range t.roots() {
+		if !isUsableDir(dir) {
+			continue
+		}
+
+		err := t.withLock(dir, func() error {
+			found, err := t.migrate(dir, isDryRun)
+			migrations = append(migrations, found...)
+			return err
+		})
+		if err != nil {
+			return migrations, err
+		}
+	}
+	return migrations, nil
+}
+
+// migrate migrates the history of dir. The caller must hold the lock of dir.
+func (t *HistoryTrash) migrate(dir string, isDryRun bool) ([]Migration, error) {
+	if t.OpenStore != nil {
+		// only the stores of this package have formats to migrate
+		return nil, nil
+	}
+
+	migrations := make([]Migration, 0)
+
+	// not synced, so that nothing but the format changes
+	history, err := LoadHistory(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(history.Path); err == nil {
+		if t.Store != HistoryStoreBolt {
+			migrations = append(migrations, Migration{Path: history.Path, From: history.Version, To: HistoryFormatVersion})
+			if isDryRun || history.Version == HistoryFormatVersion {
+				return migrations, nil
+			}
+			return migrations, history.Compact()
+		}
+
+		migrations = append(migrations, Migration{Path: history.Path, From: history.Version, To: history.Version, Imported: len(history.Entries)})
+		if !isDryRun {
+			if err := t.importHistory(dir); err != nil {
+				return migrations, err
+			}
+		}
+	}
+
+	if t.Store != HistoryStoreBolt {
+		return migrations, nil
+	}
+	dbPath := filepath.Join(dir, BoltHistoryFileName)
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) && len(migrations) == 0 {
+		return migrations, nil
+	}
+	migrations = append(migrations, Migration{Path: dbPath, From: BoltHistoryVersion, To: BoltHistoryVersion, Compacted: true})
+	if isDryRun {
+		return migrations, nil
+	}
+
+	store, err := OpenBoltHistoryStore(dbPath, t.LockTimeout)
+	if err != nil {
+		return migrations, err
+	}
+	if err := store.Compact(); err != nil {
+		_ = store.Close()
+		return migrations, errors.Wrap(err, "failed to compact history")
+	}
+	return migrations, store.Close()
+}
+
+// eachRoot calls fn with the store of each trash dir and the given entries which are still in it,
+// since another process may have restored or purged them.
+func (t *HistoryTrash) eachRoot(entries HistoryEntries, fn func(store HistoryStore, found HistoryEntries) error) error {
+	for _, dir := range t.roots() {
+		targets := make(HistoryEntries, 0)
+		for _, e := range entries {
+			if filepath.Dir(e.To) == dir {
+				targets = append(targets, e)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		err := t.withStore(dir, func(store HistoryStore) error {
+			found := make(HistoryEntries, 0, len(targets))
+			for _, e := range targets {
+				matched, err := query(t.FS, store, HistoryQuery{To: e.To})
+				if err != nil {
+					return err
+				}
+				found = append(found, matched...)
+			}
+			return fn(store, found)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withLock runs fn while holding the lock of the history in dir, so that
+// load-modify-write of the history is not interleaved with other processes.
+func (t *HistoryTrash) withLock(dir string, fn func() error) error {
+	lock, err := LockTrashDir(dir, t.LockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock history")
+	}
+
+	if err := fn(); err != nil {
+		_ = lock.Release()
+		return err
+	}
+
+	return lock.Release()
+}
+
+// withStore runs fn with the store of dir while holding its lock, after recovering an interrupted batch.
+func (t *HistoryTrash) withStore(dir string, fn func(store HistoryStore) error) error {
+	return t.withLock(dir, func() error {
+		store, err := t.openStore(dir)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(store); err != nil {
+			_ = store.Close()
+			return err
+		}
+		return store.Close()
+	})
+}
+
+// openStore opens the store of dir. The caller must hold the lock of dir.
+// A new bolt store imports the JSONL history, if any.
+func (t *HistoryTrash) openStore(dir string) (HistoryStore, error) {
+	open := func() (HistoryStore, error) {
+		return OpenHistoryStore(t.Store, dir, t.LockTimeout)
+	}
+	if t.OpenStore != nil {
+		open = func() (HistoryStore, error) {
+			return t.OpenStore(dir)
+		}
+	} else if t.Store == HistoryStoreBolt {
+		if _, err := os.Stat(filepath.Join(dir, BoltHistoryFileName)); os.IsNotExist(err) {
+			if err := t.importHistory(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	store, err := open()
+	if err != nil {
+		return nil, err
+	}
+	journal := NewJournal(dir)
+	journal.FS = t.FS
+	if err := journal.Recover(store); err != nil {
+		_ = store.Close()
+		return nil, errors.Wrap(err, "failed to recover journal")
+	}
+	return store, nil
+}
+
+// importHistory imports the JSONL history of dir into the bolt store. The caller must hold the lock of dir.
+func (t *HistoryTrash) importHistory(dir string) error {
+	store, err := OpenHistoryStore(HistoryStoreBolt, dir, t.LockTimeout)
+	if err != nil {
+		return err
+	}
+
+	n, err := ImportJSONLHistory(dir, store)
+	if err != nil {
+		_ = store.Close()
+		return errors.Wrap(err, "failed to import history")
+	}
+	if n > 0 {
+		log.Printf("imported %d entries into %v", n, filepath.Join(dir, BoltHistoryFileName))
+	}
+	return store.Close()
+}
+
+// roots returns the trash dir and the trash dirs of the other volumes, each of which has its own history.
+// The trash dirs of the other volumes are looked up once, and only the ones which gototrash has used are returned,
+// so that reading never locks nor creates anything in the trash dirs of other tools.
+func (t *HistoryTrash) roots() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.volumes == nil {
+		t.volumes = make([]string, 0)
+		for _, vt := range VolumeTrashes(t.Dir) {
+			if hasHistory(vt.Dir) {
+				t.volumes = append(t.volumes, vt.Dir)
+			}
+		}
+	}
+	return append([]string{t.Dir}, t.volumes...)
+}
+
+// forgetVolumes makes roots look up the trash dirs of the other volumes again, e.g. after one has been used.
+func (t *HistoryTrash) forgetVolumes() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.volumes = nil
+}
+
+// hasHistory tells whether gototrash has kept a history in dir.
+func hasHistory(dir string) bool {
+	for _, name := range []string{HistoryFileName, backupPath(HistoryFileName), BoltHistoryFileName, JournalFileName} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *HistoryTrash) Put(paths []string, isDryRun bool) ([]MovedFile, error) {
+	// group files by the trash on the same filesystem
+	dirs := make([]string, 0)
+	groups := make(map[string]ToBeMovedFiles)
+	for _, path := range paths {
+		from, err := validatePath(fsOrOS(t.FS), path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to validate path")
+		}
+
+		vt, err := trashFor(t.Dir, from, !isDryRun)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find trash")
+		}
+
+		if _, ok := groups[vt.Dir]; !ok {
+			dirs = append(dirs, vt.Dir)
+		}
+		to := filepath.Join(vt.Dir, filepath.Base(from))
+		groups[vt.Dir] = append(groups[vt.Dir], NewToBeMovedFile(from, to))
+	}
+
+	// files trashed at once share the batch even across volumes
+	batch := NewBatch()
+
+	if !isDryRun && slices.ContainsFunc(dirs, func(dir string) bool { return dir != t.Dir }) {
+		// the trash dir of another volume may be new to roots
+		defer t.forgetVolumes()
+	}
+
+	movedFiles := make([]MovedFile, 0, len(paths))
+	for _, dir := range dirs {
+		moved, err := t.put(dir, groups[dir], batch, isDryRun)
+		if err != nil {
+			return movedFiles, err
+		}
+		movedFiles = append(movedFiles, moved...)
+	}
+
+	return movedFiles, nil
+}
+
+func (t *HistoryTrash) put(dir string, files ToBeMovedFiles, batch Batch, isDryRun bool) ([]MovedFile, error) {
+	now := time.Now()
+	fsys := fsOrOS(t.FS)
+
+	if isDryRun {
+		return files.resolve(fsys, now).withMetadata(fsys, batch).moveEach(fsys, true, now, nil)
+	}
+
+	var movedFiles []MovedFile
+	err := t.withStore(dir, func(store HistoryStore) (err error) {
+		movedFiles, err = commit(fsys, dir, store, files, batch, now)
+		if err != nil {
+			return err
+		}
+
+		// the files are in the trash anyway, so a failed eviction is only logged
+		if _, err := enforceQuota(fsys, store, dir, t.Quota, movedFiles, now); err != nil {
+			log.Printf("failed to enforce quota on %v: %v", dir, err)
+		}
+		return nil
+	})
+	return movedFiles, err
+}
+
+// commit moves files into dir as one batch: the intent is journaled first, each file is recorded in the history
+// as soon as it's moved, and on failure the moved files are rolled back.
+// The caller must hold the lock of dir.
+func commit(fsys FileSystem, dir string, store HistoryStore, files ToBeMovedFiles, batch Batch, now time.Time) ([]MovedFile, error) {
+	resolved := files.resolve(fsys, now).withMetadata(fsys, batch)
+
+	intents := make([]HistoryEntry, len(resolved))
+	for i, f := range resolved {
+		intents[i] = NewHistoryEntry(f.From, f.To, RemovedAt(now))
+		intents[i].Metadata = f.Metadata
+	}
+
+	journal := NewJournal(dir)
+	if err := journal.Begin(intents); err != nil {
+		return nil, errors.Wrap(err, "failed to begin journal")
+	}
+
+	movedFiles, err := resolved.moveEach(fsys, false, now, func(f MovedFile) error {
+		return store.Append(NewHistoryEntriesFromMovedFiles([]MovedFile{f}))
+	})
+	if err != nil {
+		if rollbackErr := rollback(fsys, store, movedFiles); rollbackErr != nil {
+			err = errors.Join(err, rollbackErr)
+		}
+		if endErr := journal.End(); endErr != nil {
+			err = errors.Join(err, endErr)
+		}
+		return nil, errors.Wrap(err, "failed to move files")
+	}
+
+	if err := journal.End(); err != nil {
+		return nil, err
+	}
+
+	return movedFiles, nil
+}
+
+// rollback moves the files back to where they came from.
+// The files which cannot be moved back stay recorded in the history, so they can be restored later.
+func rollback(fsys FileSystem, store HistoryStore, movedFiles []MovedFile) error {
+	var errs []error
+	rolledBack := make([]MovedFile, 0, len(movedFiles))
+	for _, f := range movedFiles {
+		if err := moveFile(fsys, f.To, f.From); err != nil {
+			log.Printf("failed to roll back %v: %v", f.To, err)
+			errs = append(errs, errors.Wrapf(err, "roll back %v, it is kept in the trash", f.To))
+			continue
+		}
+		log.Printf("rolled back: %v → %v", f.To, f.From)
+		rolledBack = append(rolledBack, f)
+	}
+
+	// drop the entries of the files which have been moved back
+	if err := store.Remove(NewHistoryEntriesFromMovedFiles(rolledBack)); err != nil {
+		errs = append(errs, errors.Wrap(err, "update history"))
+	}
+
+	return errors.Join(errs...)
+}
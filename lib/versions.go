@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Versions returns the entries trashed from path, from the most recent, which is version 1.
+func Versions(entries HistoryEntries, path string) HistoryEntries {
+	versions := make(HistoryEntries, 0)
+	for _, e := range entries {
+		if e.From == path {
+			versions = append(versions, e)
+		}
+	}
+	return versions.Recent()
+}
+
+// CountVersions returns the number of entries trashed from each original path.
+func CountVersions(entries HistoryEntries) map[string]int {
+	counts := make(map[string]int, len(entries))
+	for _, e := range entries {
+		counts[e.From]++
+	}
+	return counts
+}
+
+// WriteVersions writes the versions of a path as a table numbered from the most recent, reading them from fsys.
+// A version which cannot be read is left out without renumbering the others, and its error is returned.
+func WriteVersions(w io.Writer, fsys FileSystem, versions HistoryEntries) error {
+	errs := make([]error, 0)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tID\tREMOVED AT\tSIZE\tTYPE\tIN TRASH")
+	for i, e := range versions {
+		item, err := NewListItem(fsys, e)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "version %d", i+1))
+			continue
+		}
+
+		id := item.ID
+		if item.Pinned {
+			id += "*"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			i+1, id, item.Removed, FormatSize(item.Size), item.Type, MapHomeToTilde(item.To))
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "write versions")
+	}
+	return errors.Join(errs...)
+}
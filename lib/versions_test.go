@@ -0,0 +1,57 @@
+package lib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersions(t *testing.T) {
+	at := func(day int) lib.RemovedAt {
+		return lib.RemovedAt(time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC))
+	}
+	entries := lib.HistoryEntries{
+		lib.NewHistoryEntry("/home/user/config.yaml", "/trash/config.yaml", at(1)),
+		lib.NewHistoryEntry("/home/user/other.yaml", "/trash/other.yaml", at(2)),
+		lib.NewHistoryEntry("/home/user/config.yaml", "/trash/config.20240103T000000Z.yaml", at(3)),
+		lib.NewHistoryEntry("/home/user/config.yaml", "/trash/config.20240102T000000Z.yaml", at(2)),
+	}
+
+	// 新しいものから並ぶ
+	versions := lib.Versions(entries, "/home/user/config.yaml")
+	assert.Equal(t, []string{
+		"/trash/config.20240103T000000Z.yaml",
+		"/trash/config.20240102T000000Z.yaml",
+		"/trash/config.yaml",
+	}, []string{versions[0].To, versions[1].To, versions[2].To})
+	assert.Empty(t, lib.Versions(entries, "/home/user"))
+
+	assert.Equal(t, map[string]int{"/home/user/config.yaml": 3, "/home/user/other.yaml": 1}, lib.CountVersions(entries))
+
+	for i := range versions {
+		versions[i].Metadata = &lib.Metadata{Size: int64(i), Type: lib.FileTypeFile}
+	}
+	versions[1].Pinned = true
+
+	var buf bytes.Buffer
+	assert.NoError(t, lib.WriteVersions(&buf, lib.NewMemFileSystem(), versions))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[1], "1 "))
+	assert.Contains(t, lines[2], versions[1].ID()+"*")
+	assert.Contains(t, lines[3], "2024-01-01T00:00:00Z")
+
+	// 読めないバージョンは行ごと省かれ、残りの番号は --restore で使う番号のまま
+	versions[1].Metadata = nil
+	buf.Reset()
+	err := lib.WriteVersions(&buf, lib.NewMemFileSystem(), versions)
+	assert.ErrorContains(t, err, "version 2")
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "1 "))
+	assert.True(t, strings.HasPrefix(lines[2], "3 "))
+}
@@ -0,0 +1,199 @@
+package lib
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+// VolumeTrash is a trash dir which lives at the top of a mounted filesystem.
+// ref: https://specifications.freedesktop.org/trash-spec/latest/#id-1.6.6
+type VolumeTrash struct {
+	Dir string
+	Top string
+}
+
+// MountPoint returns the top directory of the filesystem which path belongs to.
+func MountPoint(path string) (string, error) {
+	path, err := existingAncestor(path)
+	if err != nil {
+		return "", err
+	}
+
+	dev, err := deviceID(path)
+	if err != nil {
+		return "", errors.Wrap(err, "device id")
+	}
+
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil
+		}
+
+		parentDev, err := deviceID(parent)
+		if err != nil {
+			return "", errors.Wrap(err, "device id")
+		}
+		if parentDev != dev {
+			return path, nil
+		}
+		path = parent
+	}
+}
+
+// SameDevice reports whether a and b are on the same filesystem.
+// Paths which don't exist yet are resolved to their nearest existing ancestor.
+func SameDevice(a, b string) (bool, error) {
+	ids := make([]uint64, 2)
+	for i, path := range []string{a, b} {
+		p, err := existingAncestor(path)
+		if err != nil {
+			return false, err
+		}
+		id, err := deviceID(p)
+		if err != nil {
+			return false, errors.Wrap(err, "device id")
+		}
+		ids[i] = id
+	}
+	return ids[0] == ids[1], nil
+}
+
+func existingAncestor(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrap(err, "abs")
+	}
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", errors.Newf("no existing ancestor: %v", path)
+		}
+		path = parent
+	}
+}
+
+// volumeTrashCandidates returns `$topdir/.Trash/$uid` and `$topdir/.Trash-$uid` in order of preference.
+func volumeTrashCandidates(top string) (shared, private string) {
+	uid := strconv.Itoa(os.Getuid())
+	return filepath.Join(top, ".Trash", uid), filepath.Join(top, ".Trash-"+uid)
+}
+
+// isSharedTrashUsable checks `$topdir/.Trash` as the spec requires:
+// it must be a real directory (not a symlink) with the sticky bit set.
+func isSharedTrashUsable(top string) bool {
+	fi, err := os.Lstat(filepath.Join(top, ".Trash"))
+	if err != nil {
+		return false
+	}
+	if fi.Mode()&os.ModeSymlink != 0 || !fi.IsDir() {
+		log.Printf("%v is not a directory, skip it", filepath.Join(top, ".Trash"))
+		return false
+	}
+	if fi.Mode()&os.ModeSticky == 0 {
+		log.Printf("%v has no sticky bit, skip it", filepath.Join(top, ".Trash"))
+		return false
+	}
+	return true
+}
+
+// findVolumeTrash returns the trash dir for the volume mounted at top.
+// When create is true, missing directories are created.
+func findVolumeTrash(top string, create bool) (VolumeTrash, bool) {
+	shared, private := volumeTrashCandidates(top)
+
+	if isSharedTrashUsable(top) {
+		if isUsableDir(shared) {
+			return VolumeTrash{Dir: shared, Top: top}, true
+		}
+		if create {
+			if err := os.Mkdir(shared, 0700); err == nil {
+				return VolumeTrash{Dir: shared, Top: top}, true
+			}
+		}
+	}
+
+	if isUsableDir(private) {
+		return VolumeTrash{Dir: private, Top: top}, true
+	}
+	if create {
+		if err := os.Mkdir(private, 0700); err != nil {
+			log.Printf("failed to create %v: %v", private, err)
+			return VolumeTrash{}, false
+		}
+		return VolumeTrash{Dir: private, Top: top}, true
+	}
+
+	// dry run: the dir would be created
+	if _, err := os.Lstat(private); os.IsNotExist(err) {
+		return VolumeTrash{Dir: private, Top: top}, true
+	}
+	return VolumeTrash{}, false
+}
+
+func isUsableDir(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.IsDir()
+}
+
+// trashFor returns the trash which path should be moved into.
+// Files on the same filesystem as home go to home, the others go to the trash of their volume.
+// If the volume has no usable trash, it falls back to home.
+func trashFor(home, path string, create bool) (VolumeTrash, error) {
+	same, err := SameDevice(home, path)
+	if err != nil {
+		return VolumeTrash{}, errors.Wrap(err, "same device")
+	}
+	if same {
+		return VolumeTrash{Dir: home}, nil
+	}
+
+	top, err := MountPoint(path)
+	if err != nil {
+		return VolumeTrash{}, errors.Wrap(err, "mount point")
+	}
+
+	vt, ok := findVolumeTrash(top, create)
+	if !ok {
+		log.Printf("no usable trash on %v, use %v", top, home)
+		return VolumeTrash{Dir: home}, nil
+	}
+	return vt, nil
+}
+
+// VolumeTrashes returns the existing trash dirs of all mounted filesystems except the one of home.
+func VolumeTrashes(home string) []VolumeTrash {
+	mounts, err := MountPoints()
+	if err != nil {
+		log.Printf("failed to list mount points: %v", err)
+		return nil
+	}
+
+	trashes := make([]VolumeTrash, 0)
+	seen := map[string]struct{}{home: {}}
+	for _, top := range mounts {
+		shared, private := volumeTrashCandidates(top)
+
+		candidates := []string{private}
+		if isSharedTrashUsable(top) {
+			candidates = []string{shared, private}
+		}
+
+		for _, dir := range candidates {
+			if _, ok := seen[dir]; ok || !isUsableDir(dir) {
+				continue
+			}
+			seen[dir] = struct{}{}
+			trashes = append(trashes, VolumeTrash{Dir: dir, Top: top})
+		}
+	}
+
+	return trashes
+}
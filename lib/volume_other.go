@@ -0,0 +1,8 @@
+//go:build !unix
+
+package lib
+
+// deviceID is not supported, so every path is treated as being on the same filesystem.
+func deviceID(path string) (uint64, error) {
+	return 0, nil
+}
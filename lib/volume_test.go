@@ -0,0 +1,96 @@
+//go:build unix
+
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/naoking158/go-to-trash/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// 同じディレクトリ配下は同じファイルシステムとして扱われる（存在しないパスは祖先で判定）
+func TestSameDevice(t *testing.T) {
+	dir := t.TempDir()
+	same, err := lib.SameDevice(dir, filepath.Join(dir, "not", "exist"))
+	assert.NoError(t, err)
+	assert.True(t, same)
+
+	top, err := lib.MountPoint(dir)
+	assert.NoError(t, err)
+	assert.True(t, filepath.IsAbs(top))
+}
+
+// .Trash が無ければ .Trash-$uid が作成される
+func TestFindVolumeTrash_Private(t *testing.T) {
+	top := t.TempDir()
+	uid := strconv.Itoa(os.Getuid())
+
+	vt, ok := lib.FindVolumeTrash(top, true)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(top, ".Trash-"+uid), vt.Dir)
+	assert.Equal(t, top, vt.Top)
+	assert.DirExists(t, vt.Dir)
+}
+
+// sticky bit 付きの .Trash があれば .Trash/$uid が使われる
+func TestFindVolumeTrash_Shared(t *testing.T) {
+	top := t.TempDir()
+	uid := strconv.Itoa(os.Getuid())
+
+	shared := filepath.Join(top, ".Trash")
+	assert.NoError(t, os.Mkdir(shared, 0777))
+	assert.NoError(t, os.Chmod(shared, 0777|os.ModeSticky))
+
+	vt, ok := lib.FindVolumeTrash(top, true)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(shared, uid), vt.Dir)
+}
+
+// sticky bit の無い .Trash は使われない
+func TestFindVolumeTrash_SharedWithoutSticky(t *testing.T) {
+	top := t.TempDir()
+	uid := strconv.Itoa(os.Getuid())
+	assert.NoError(t, os.Mkdir(filepath.Join(top, ".Trash"), 0777))
+
+	vt, ok := lib.FindVolumeTrash(top, true)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(top, ".Trash-"+uid), vt.Dir)
+}
+
+// ボリュームのゴミ箱では Path が top からの相対パスで保存され、読み込み時に絶対パスへ戻る
+func TestFreedesktopTrash_VolumeRelativePath(t *testing.T) {
+	top := t.TempDir()
+	src := filepath.Join(top, "dir", "file.txt")
+	createDummyFile(t, src)
+
+	trash := &lib.FreedesktopTrash{Dir: filepath.Join(top, ".Trash-"+strconv.Itoa(os.Getuid())), Top: top}
+	_, err := trash.Put([]string{src}, false)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(trash.InfoDir(), "file.txt.trashinfo"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Path=dir/file.txt\n")
+
+	entries, err := trash.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, src, entries[0].From)
+}
+
+// gototrash の履歴が無いボリュームのゴミ箱（他のツールのもの）は読み取りの対象にならない
+func TestHasHistory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "files"), 0700))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "info"), 0700))
+	assert.False(t, lib.HasHistory(dir))
+
+	for _, name := range []string{lib.HistoryFileName, lib.HistoryFileName + lib.HistoryBackupExt, lib.BoltHistoryFileName, lib.JournalFileName} {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+		assert.True(t, lib.HasHistory(dir), name)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package lib
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/cockroachdb/errors"
+)
+
+func deviceID(path string) (uint64, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.Newf("unexpected stat type: %T", fi.Sys())
+	}
+	return uint64(st.Dev), nil
+}
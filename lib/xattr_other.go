@@ -0,0 +1,7 @@
+//go:build !(linux || darwin)
+
+package lib
+
+func copyXattrs(from, to string) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build linux || darwin
+
+package lib
+
+import (
+	"bytes"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs copies extended attributes from from to to without following symlinks.
+func copyXattrs(from, to string) error {
+	size, err := unix.Llistxattr(from, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return errors.Wrap(err, "llistxattr")
+	}
+	if size == 0 {
+		return nil
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(from, buf)
+	if err != nil {
+		return errors.Wrap(err, "llistxattr")
+	}
+
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+
+		valueSize, err := unix.Lgetxattr(from, attr, nil)
+		if err != nil {
+			return errors.Wrapf(err, "lgetxattr: %v", attr)
+		}
+		value := make([]byte, valueSize)
+		valueSize, err = unix.Lgetxattr(from, attr, value)
+		if err != nil {
+			return errors.Wrapf(err, "lgetxattr: %v", attr)
+		}
+
+		if err := unix.Lsetxattr(to, attr, value[:valueSize], 0); err != nil {
+			// the destination filesystem may not support it, or the namespace may need privileges
+			if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+				continue
+			}
+			return errors.Wrapf(err, "lsetxattr: %v", attr)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/naoking158/go-to-trash/lib"
+)
+
+// runList prints the entries in the trash.
+func (cli *CLI) runList(args []string) int {
+	var (
+		verbose bool
+		reverse bool
+		format  string
+		sortKey string
+		since   string
+		until   string
+		prefix  string
+	)
+
+	flags := cli.newFlagSet(Name + " list")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.StringVar(&format, "format", lib.ListFormatTable, "output format: table, json, csv or ndjson")
+	flags.StringVar(&sortKey, "sort", lib.ListSortRemoved, "sort by removed, from, to, size, id or type")
+	flags.BoolVarP(&reverse, "reverse", "r", false, "reverse the order")
+	flags.StringVar(&since, "since", "", "only entries removed at or after this time (e.g. 2024-01-31, 7d)")
+	flags.StringVar(&until, "until", "", "only entries removed before this time (e.g. 2024-01-31T12:00:00, 1d)")
+	flags.StringVar(&prefix, "prefix", "", "only entries whose original path is under this path")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	now := time.Now()
+	var q lib.HistoryQuery
+	for _, f := range []struct {
+		value string
+		dst   *time.Time
+	}{{since, &q.Since}, {until, &q.Until}} {
+		if f.value == "" {
+			continue
+		}
+		t, err := lib.ParseTime(f.value, now)
+		if err != nil {
+			fmt.Fprintf(cli.Stderr, "%v\n", err)
+			return 1
+		}
+		*f.dst = t
+	}
+	if prefix != "" {
+		p, err := lib.NormalizePath(prefix)
+		if err != nil {
+			log.Println(err)
+			fmt.Fprintf(cli.Stderr, "failed to normalize path: %v\n", err)
+			return 1
+		}
+		q.FromPrefix = p
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	entries, err := trash.Query(q)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	items, err := lib.ListEntries(lib.OSFileSystem{}, entries, sortKey, reverse)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to list: %v\n", err)
+		return 1
+	}
+
+	if err := lib.WriteList(cli.Stdout, items, format); err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to list: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -15,9 +15,14 @@ func main() {
 	}
 
 	cli := CLI{
-		Stdout:   os.Stdout,
-		Stderr:   os.Stderr,
-		TrashDir: config.TrashDir,
+		Stdin:           os.Stdin,
+		Stdout:          os.Stdout,
+		Stderr:          os.Stderr,
+		TrashDir:        config.TrashDir,
+		Backend:         config.Backend,
+		RestoreConflict: config.RestoreConflict,
+		Quota:           config.Quota,
+		HistoryStore:    config.HistoryStore,
 	}
 	os.Exit(cli.Run(os.Args))
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// runMigrate rewrites the histories in the current format and compacts them.
+func (cli *CLI) runMigrate(args []string) int {
+	var (
+		dryrun  bool
+		verbose bool
+		yes     bool
+	)
+
+	flags := cli.newFlagSet(Name + " migrate")
+	flags.BoolVarP(&dryrun, "dryrun", "n", false, "no execute, just show what would be done")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation on a terminal")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	if !cli.guardSubcommand("migrate", fmt.Sprintf("migrate the histories of %s?", cli.TrashDir), yes || dryrun) {
+		fmt.Fprintln(cli.Stdout, "canceled")
+		return 1
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	migrations, err := trash.Migrate(dryrun)
+	for _, m := range migrations {
+		switch {
+		case m.Compacted && dryrun:
+			fmt.Fprintf(cli.Stdout, "would compact: %s\n", m.Path)
+		case m.Compacted:
+			fmt.Fprintf(cli.Stdout, "compacted: %s\n", m.Path)
+		case m.Imported > 0 && dryrun:
+			fmt.Fprintf(cli.Stdout, "would import: %s (%d entries)\n", m.Path, m.Imported)
+		case m.Imported > 0:
+			fmt.Fprintf(cli.Stdout, "imported: %s (%d entries)\n", m.Path, m.Imported)
+		case m.From == m.To:
+			fmt.Fprintf(cli.Stdout, "up to date: %s (version %d)\n", m.Path, m.To)
+		case dryrun:
+			fmt.Fprintf(cli.Stdout, "would migrate: %s (version %d → %d)\n", m.Path, m.From, m.To)
+		default:
+			fmt.Fprintf(cli.Stdout, "migrated: %s (version %d → %d)\n", m.Path, m.From, m.To)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to migrate: %v\n", err)
+		return 1
+	}
+
+	if len(migrations) == 0 {
+		fmt.Fprintln(cli.Stdout, "nothing to migrate")
+	}
+
+	return 0
+}
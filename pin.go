@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// runPin pins (or unpins) the entries matching the given patterns, so that the quota never evicts them.
+func (cli *CLI) runPin(args []string, pinned bool) int {
+	name, done := "pin", "pinned"
+	if !pinned {
+		name, done = "unpin", "unpinned"
+	}
+
+	var (
+		verbose    bool
+		allMatches bool
+		yes        bool
+	)
+
+	flags := cli.newFlagSet(Name + " " + name)
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.BoolVarP(&allMatches, "all-matches", "a", false, name+" all matched entries instead of the most recent one")
+	flags.BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation on a terminal")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		fmt.Fprintf(cli.Stderr, "usage: %s %s [-a] <path|glob|id>...\n", Name, name)
+		return 1
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	entries, err := trash.Entries()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	selected, exitCode := cli.matchEntries(entries, patterns, allMatches)
+	if len(selected) == 0 {
+		return exitCode
+	}
+
+	if !cli.guardSubcommand(name, fmt.Sprintf("%s %d entries?", name, len(selected)), yes) {
+		fmt.Fprintln(cli.Stdout, "canceled")
+		return 1
+	}
+
+	if err := trash.Pin(selected, pinned); err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to %s: %v\n", name, err)
+		return 1
+	}
+
+	for _, e := range selected {
+		fmt.Fprintf(cli.Stdout, "%s: %s ← %s\n", done, e.To, e.From)
+	}
+
+	return exitCode
+}
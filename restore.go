@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/naoking158/go-to-trash/lib"
+)
+
+// runRestore restores files matching the given patterns without the interactive UI.
+// Without patterns, it launches the interactive UI just like `--restore`.
+func (cli *CLI) runRestore(args []string) int {
+	var (
+		dryrun     bool
+		verbose    bool
+		allMatches bool
+		yes        bool
+		restoreTo  string
+		conflict   string
+	)
+
+	flags := cli.newFlagSet(Name + " restore")
+	flags.BoolVarP(&dryrun, "dryrun", "n", false, "no execute, just show what would be done")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.BoolVarP(&allMatches, "all-matches", "a", false, "restore all matched entries instead of the most recent one")
+	flags.BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation on a terminal")
+	flags.StringVar(&restoreTo, "to", "", "restore files into this directory instead of their original location")
+	flags.StringVar(&conflict, "conflict", cli.RestoreConflict, "what to do when a restored file already exists: fail, rename, overwrite or ask")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	opts, err := cli.restoreOptions(restoreTo, conflict, dryrun)
+	if err != nil {
+		return 1
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		return cli.restoreInteractive(trash, opts)
+	}
+	opts.Ask = cli.askConflict
+
+	entries, err := trash.Entries()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	toBeRestored, exitCode := cli.matchEntries(entries, patterns, allMatches)
+	if len(toBeRestored) == 0 {
+		return exitCode
+	}
+
+	if !cli.guardSubcommand("restore", fmt.Sprintf("restore %d entries?", len(toBeRestored)), yes || dryrun) {
+		fmt.Fprintln(cli.Stdout, "canceled")
+		return 1
+	}
+
+	restoredFiles, err := lib.RestoreEntries(trash, toBeRestored, opts)
+	cli.printRestored(restoredFiles, dryrun)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to restore: %v\n", err)
+		return 1
+	}
+
+	return exitCode
+}
+
+// printRestored reports where the files have been restored, or would be with dryrun.
+func (cli *CLI) printRestored(files []lib.RestoredFile, dryrun bool) {
+	for _, f := range files {
+		if dryrun {
+			fmt.Fprintf(cli.Stdout, "would restore: %s → %s", f.From, f.To)
+		} else {
+			fmt.Fprintf(cli.Stdout, "restored: %s → %s", f.From, f.To)
+		}
+		if f.Renamed {
+			fmt.Fprint(cli.Stdout, " (renamed, destination existed)")
+		}
+		if f.Overwritten != "" {
+			fmt.Fprintf(cli.Stdout, " (previous file trashed: %s)", f.Overwritten)
+		}
+		fmt.Fprintln(cli.Stdout)
+		if f.Leftover != nil {
+			fmt.Fprintf(cli.Stderr, "warning: %s has been copied back, but is partly left in the trash: %v\n", f.From, f.Leftover)
+		}
+	}
+}
+
+// matchEntries returns the entries matching patterns, only the most recent one for each pattern unless allMatches.
+// The exit code is 1 if any pattern matches nothing.
+func (cli *CLI) matchEntries(entries lib.HistoryEntries, patterns []string, allMatches bool) (lib.HistoryEntries, int) {
+	exitCode := 0
+	selected := make(lib.HistoryEntries, 0)
+	seen := make(map[string]struct{})
+	for _, pattern := range patterns {
+		matched := lib.MatchEntries(entries, pattern)
+		if len(matched) == 0 {
+			fmt.Fprintf(cli.Stderr, "no entry matched: %s\n", pattern)
+			exitCode = 1
+			continue
+		}
+
+		if !allMatches {
+			matched = matched[:1]
+		}
+		for _, e := range matched {
+			// the same entry may match several patterns
+			if _, ok := seen[e.To]; ok {
+				continue
+			}
+			seen[e.To] = struct{}{}
+			selected = append(selected, e)
+		}
+	}
+	return selected, exitCode
+}
+
+func (cli *CLI) restoreInteractive(trash lib.Trash, opts lib.RestoreOptions) int {
+	entries, err := trash.Entries()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+	if err := lib.Restore(trash, entries, opts); err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "there's been an error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (cli *CLI) restoreOptions(restoreTo, conflict string, dryrun bool) (lib.RestoreOptions, error) {
+	policy, err := lib.ParseConflictPolicy(conflict)
+	if err != nil {
+		fmt.Fprintf(cli.Stderr, "%v\n", err)
+		return lib.RestoreOptions{}, err
+	}
+
+	opts := lib.RestoreOptions{IsDryRun: dryrun, Conflict: policy}
+	if restoreTo == "" {
+		return opts, nil
+	}
+
+	dir, err := lib.NormalizePath(restoreTo)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to normalize path: %v\n", err)
+		return opts, err
+	}
+	if fi, err := os.Stat(dir); err == nil && !fi.IsDir() {
+		err := fmt.Errorf("not a directory: %s", restoreTo)
+		fmt.Fprintf(cli.Stderr, "%v\n", err)
+		return opts, err
+	}
+
+	// missing directories are created on restore
+	opts.Dir = dir
+	return opts, nil
+}
+
+// askConflict asks on the terminal what to do with a conflict.
+func (cli *CLI) askConflict(c lib.RestoreConflict) (lib.ConflictPolicy, error) {
+	for {
+		fmt.Fprintf(cli.Stderr, "%s already exists. [r]ename, [o]verwrite (trash the current file), [s]kip, [f]ail? ", c.Dest)
+
+		line, err := cli.stdinReader().ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("no answer: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "r", "rename":
+			return lib.ConflictRename, nil
+		case "o", "overwrite":
+			return lib.ConflictOverwrite, nil
+		case "s", "skip":
+			return lib.ConflictSkip, nil
+		case "f", "fail":
+			return lib.ConflictFail, nil
+		}
+	}
+}
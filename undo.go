@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/naoking158/go-to-trash/lib"
+)
+
+// runUndo restores every entry of the most recent invocations, or of the given batch IDs.
+func (cli *CLI) runUndo(args []string) int {
+	var (
+		dryrun   bool
+		verbose  bool
+		yes      bool
+		count    int
+		conflict string
+	)
+
+	flags := cli.newFlagSet(Name + " undo")
+	// -n は件数に使うので dryrun は長い名前だけ
+	flags.BoolVar(&dryrun, "dryrun", false, "no execute, just show what would be restored")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation on a terminal")
+	flags.IntVarP(&count, "count", "n", 1, "undo this many of the most recent invocations")
+	flags.StringVar(&conflict, "conflict", cli.RestoreConflict, "what to do when a restored file already exists: fail, rename, overwrite or ask")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	if count < 1 {
+		fmt.Fprintf(cli.Stderr, "invalid count: %d\n", count)
+		return 1
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	opts, err := cli.restoreOptions("", conflict, dryrun)
+	if err != nil {
+		return 1
+	}
+	opts.Ask = cli.askConflict
+
+	entries, err := trash.Entries()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	batches, exitCode := cli.selectBatches(entries, flags.Args(), count)
+	if len(batches) == 0 {
+		if exitCode == 0 {
+			fmt.Fprintln(cli.Stdout, "nothing to undo")
+		}
+		return exitCode
+	}
+
+	toBeRestored := make(lib.HistoryEntries, 0)
+	for _, b := range batches {
+		fmt.Fprintln(cli.Stdout, formatBatch(b))
+		toBeRestored = append(toBeRestored, b.Entries...)
+	}
+
+	if !cli.guardSubcommand("undo", fmt.Sprintf("restore %d entries?", len(toBeRestored)), yes || dryrun) {
+		fmt.Fprintln(cli.Stdout, "canceled")
+		return 1
+	}
+
+	restoredFiles, err := lib.RestoreEntries(trash, toBeRestored, opts)
+	cli.printRestored(restoredFiles, dryrun)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to undo: %v\n", err)
+		return 1
+	}
+
+	return exitCode
+}
+
+// selectBatches returns the batches with the given IDs, or the count most recent ones without IDs.
+// The exit code is 1 if any ID matches nothing.
+func (cli *CLI) selectBatches(entries lib.HistoryEntries, ids []string, count int) ([]lib.BatchEntries, int) {
+	if len(ids) == 0 {
+		batches := lib.GroupByBatch(entries)
+		return batches[:min(count, len(batches))], 0
+	}
+
+	exitCode := 0
+	batches := make([]lib.BatchEntries, 0, len(ids))
+	for _, id := range ids {
+		b, ok := lib.FindBatch(entries, id)
+		if !ok {
+			fmt.Fprintf(cli.Stderr, "no batch matched: %s\n", id)
+			exitCode = 1
+			continue
+		}
+		batches = append(batches, b)
+	}
+	return batches, exitCode
+}
+
+func formatBatch(b lib.BatchEntries) string {
+	id := b.ID
+	if id == "" {
+		id = "-"
+	}
+	line := fmt.Sprintf("batch %s, removed at %s, %d entries", id, lib.RemovedAt(b.Removed()), len(b.Entries))
+	if batch, ok := b.Batch(); ok && len(batch.Cmdline) > 0 {
+		line += fmt.Sprintf(": %s", batch.CommandLine())
+	}
+	return line
+}
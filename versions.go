@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/naoking158/go-to-trash/lib"
+)
+
+// runVersions lists the versions of a path in the trash, and restores one of them with --restore.
+func (cli *CLI) runVersions(args []string) int {
+	var (
+		dryrun    bool
+		verbose   bool
+		version   int
+		restoreTo string
+		conflict  string
+	)
+
+	flags := cli.newFlagSet(Name + " versions")
+	flags.BoolVarP(&dryrun, "dryrun", "n", false, "no execute, just show what would be done")
+	flags.BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	flags.IntVar(&version, "restore", 0, "restore this version (1 is the most recent)")
+	flags.StringVar(&restoreTo, "to", "", "restore files into this directory instead of their original location")
+	flags.StringVar(&conflict, "conflict", cli.RestoreConflict, "what to do when a restored file already exists: fail, rename, overwrite or ask")
+
+	if code, ok := cli.parse(flags, args); !ok {
+		return code
+	}
+
+	cli.setVerbose(verbose)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintf(cli.Stderr, "usage: %s versions [--restore N] <path>\n", Name)
+		return 1
+	}
+
+	path, err := lib.NormalizePath(flags.Arg(0))
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to normalize path: %v\n", err)
+		return 1
+	}
+
+	trash, err := cli.openTrash()
+	if err != nil {
+		return 1
+	}
+
+	entries, err := trash.Query(lib.HistoryQuery{From: path})
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to load history: %v\n", err)
+		return 1
+	}
+
+	versions := lib.Versions(entries, path)
+	if len(versions) == 0 {
+		fmt.Fprintf(cli.Stderr, "no version of %s in the trash\n", flags.Arg(0))
+		return 1
+	}
+
+	if version == 0 {
+		if err := lib.WriteVersions(cli.Stdout, lib.OSFileSystem{}, versions); err != nil {
+			log.Println(err)
+			fmt.Fprintf(cli.Stderr, "failed to list versions: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if version < 0 || version > len(versions) {
+		fmt.Fprintf(cli.Stderr, "no version %d of %s (1 to %d)\n", version, flags.Arg(0), len(versions))
+		return 1
+	}
+
+	opts, err := cli.restoreOptions(restoreTo, conflict, dryrun)
+	if err != nil {
+		return 1
+	}
+	opts.Ask = cli.askConflict
+
+	restoredFiles, err := lib.RestoreEntries(trash, versions[version-1:version], opts)
+	cli.printRestored(restoredFiles, dryrun)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(cli.Stderr, "failed to restore: %v\n", err)
+		return 1
+	}
+
+	return 0
+}